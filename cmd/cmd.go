@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -15,28 +20,398 @@ import (
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 	"github.com/ctII/filebrowserui/logbuffer"
+	"github.com/ctII/filebrowserui/wal"
+	"go.etcd.io/bbolt"
 )
 
-func logic(w fyne.Window) {
-	if config == nil { // TODO: use config.loaded?
-		err := parseConfig()
+// appState is everything that has to be cleaned up when the application quits.
+type appState struct {
+	mu sync.Mutex
+
+	db      *bbolt.DB
+	uploads *uploadManager
+
+	// stopCompaction of the WAL history
+	stopCompaction context.CancelFunc
+
+	// configErr from parsing the configuration on startup, shown by logic before anything else
+	configErr error
+
+	// cache of the filebrowser being browsed, shown in the debug window
+	cache *NodeCache
+
+	// stopRevalidation of the listings in cache
+	stopRevalidation context.CancelFunc
+
+	// offline cache of directory listings, nil if it could not be opened
+	offline *offlineCache
+
+	// handOffs of paths to upload, from the command line or from other instances
+	handOffs handOffQueue
+
+	// closed is true once close was called, anything set afterwards is closed right away
+	closed bool
+}
+
+// setWAL database and the cancel func of its history compaction, returning false if the application already quit.
+func (s *appState) setWAL(db *bbolt.DB, stopCompaction context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		stopCompaction()
+		if err := db.Close(); err != nil {
+			slog.Error("could not close WAL database", "error", err)
+		}
+		return false
+	}
+
+	s.db = db
+	s.stopCompaction = stopCompaction
+
+	return true
+}
+
+// setUploads manager, returning false if the application already quit.
+func (s *appState) setUploads(uploads *uploadManager) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		if err := uploads.Stop(); err != nil {
+			slog.Error("could not stop upload manager", "error", err)
+		}
+		return false
+	}
+
+	s.uploads = uploads
+
+	return true
+}
+
+// setOfflineCache of directory listings, returning false if the application already quit.
+func (s *appState) setOfflineCache(offline *offlineCache) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		if err := offline.Close(); err != nil {
+			slog.Error("could not close offline cache", "error", err)
+		}
+		return false
+	}
+
+	s.offline = offline
+
+	return true
+}
+
+// setCache of the filebrowser being browsed and the cancel func of its revalidation, returning false if the application already quit.
+func (s *appState) setCache(cache *NodeCache, stopRevalidation context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		stopRevalidation()
+		return false
+	}
+
+	s.cache = cache
+	s.stopRevalidation = stopRevalidation
+
+	return true
+}
+
+// debugInfo of the application for the debug window.
+func (s *appState) debugInfo() string {
+	s.mu.Lock()
+	cache := s.cache
+	s.mu.Unlock()
+
+	if cache == nil {
+		return "node cache: not browsing yet"
+	}
+	return cache.Stats().String()
+}
+
+// close the upload manager, the WAL database and the offline cache, the first two in that order so every upload records its state.
+func (s *appState) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	var err error
+
+	if s.uploads != nil {
+		if err2 := s.uploads.Stop(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not stop upload manager: %w", err2))
+		}
+		s.uploads = nil
+	}
+
+	if s.stopCompaction != nil {
+		s.stopCompaction()
+	}
+
+	if s.stopRevalidation != nil {
+		s.stopRevalidation()
+	}
+
+	if s.db != nil {
+		if err2 := s.db.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close WAL database: %w", err2))
+		}
+		s.db = nil
+	}
+
+	if s.offline != nil {
+		if err2 := s.offline.Close(); err2 != nil {
+			err = errors.Join(err, err2)
+		}
+		s.offline = nil
+	}
+
+	return err
+}
+
+// openWAL in the configuration directory, repairing it if a bad shutdown left it broken.
+func openWAL(w fyne.Window) (*bbolt.DB, *wal.WriteAheadLog, error) {
+	if err := os.MkdirAll(config.Dir, 0750); err != nil {
+		return nil, nil, fmt.Errorf("could not create configuration directory (%v): %w", config.Dir, err)
+	}
+
+	walPath := filepath.Join(config.Dir, walFileName)
+
+	// bbolt holds a file lock for as long as the database is open, the timeout stops us from waiting forever on another instance
+	db, err := bbolt.Open(walPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open upload WAL (%v), is filebrowserui already running?: %w", walPath, err)
+	}
+
+	report, err := wal.Check(db)
+	if err != nil {
+		return nil, nil, errors.Join(err, db.Close())
+	}
+
+	// an empty version is a new database, which NewWriteAheadLog initializes
+	if report.Version != "" && !report.OK() {
+		slog.Warn("upload WAL has problems, repairing it", "path", walPath, "problems", len(report.Problems))
+
+		report, err = wal.Repair(db, wal.RepairOptions{Quarantine: true})
 		if err != nil {
-			handleError(w, fmt.Errorf("WARNING configuration file error: %w", err), func() {
-				go logic(w)
+			return nil, nil, errors.Join(err, db.Close())
+		}
+
+		var repaired, unrepaired []string
+		for i := range report.Problems {
+			if report.Problems[i].Repaired {
+				repaired = append(repaired, report.Problems[i].String())
+			} else {
+				unrepaired = append(unrepaired, report.Problems[i].String())
+			}
+		}
+
+		if len(repaired) > 0 {
+			fyne.Do(func() {
+				notify(w, notifyInfo, "The upload log was not shut down cleanly and has been repaired. "+
+					"Broken uploads were moved into quarantine, see \"filebrowserui wal-check\".\n\n"+strings.Join(repaired, "\n"))
+			})
+		}
+
+		if len(unrepaired) > 0 {
+			slog.Error("upload WAL has problems that could not be repaired", "path", walPath, "problems", len(unrepaired))
+			fyne.Do(func() {
+				notify(w, notifyError, "The upload log has problems that could not be repaired, "+
+					"see \"filebrowserui wal-check\".\n\n"+strings.Join(unrepaired, "\n"))
 			})
+		}
+	}
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		return nil, nil, errors.Join(err, db.Close())
+	}
+
+	return db, writeAheadLog, nil
+}
+
+// describeBatches for a person to read, one line per batch.
+func describeBatches(batches []wal.Batch) string {
+	var b strings.Builder
+
+	for _, batch := range batches {
+		dest, err := batch.Destination()
+		if err != nil {
+			dest = err.Error()
+		}
+
+		files, size := 0, int64(0)
+		for item, err := range batch.UnfinishedItems() {
+			if err != nil {
+				break
+			}
+			files++
+			size += item.Size - item.BytesConfirmed
+		}
+
+		fmt.Fprintf(&b, "%v: %v files, %v left\n", strings.ReplaceAll(dest, "\n", "\\n"), files, formatBytes(size))
+	}
+
+	return b.String()
+}
+
+// startUploads for sess, asking the user before resuming any uploads left unfinished by a previous run.
+func startUploads(w fyne.Window, writeAheadLog *wal.WriteAheadLog, sess *filebrowserSession) (*uploadManager, error) {
+	uploads, err := newUploadManager(
+		writeAheadLog,
+		sess,
+		func(bid string, path string, err error) {
+			slog.Error("could not upload file", "batch", bid, "path", path, "error", err)
+			fyne.Do(func() { notify(w, notifyError, fmt.Sprintf("could not upload (%v): %v", path, err)) })
+		},
+		func(err error) {
+			slog.Error("upload manager error", "error", err)
+			fyne.Do(func() { notify(w, notifyError, err.Error()) })
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create upload manager: %w", err)
+	}
+
+	unfinished, err := uploads.Start()
+	if err != nil {
+		return nil, fmt.Errorf("could not start upload manager: %w", err)
+	}
+
+	if len(unfinished) == 0 {
+		return uploads, nil
+	}
+
+	resume := make(chan struct{})
+	notNow := make(chan struct{})
+
+	fyne.DoAndWait(func() {
+		w.SetContent(
+			container.NewVBox(
+				widget.NewLabel(fmt.Sprintf("%v uploads were not finished the last time filebrowserui ran:", len(unfinished))),
+				widget.NewLabel(describeBatches(unfinished)),
+				widget.NewButton("Resume uploads", sync.OnceFunc(func() { close(resume) })),
+				widget.NewButton("Not now", sync.OnceFunc(func() { close(notNow) })),
+			),
+		)
+	})
+
+	select {
+	case <-resume:
+		if err := uploads.Resume(unfinished); err != nil {
+			return uploads, fmt.Errorf("could not resume uploads: %w", err)
+		}
+	case <-notNow:
+	}
+
+	return uploads, nil
+}
+
+// askBrowseOffline after login failed with err because filebrowser can't be reached, false to try logging in again.
+func askBrowseOffline(w fyne.Window, err error) bool {
+	browseOffline := make(chan struct{})
+	tryAgain := make(chan struct{})
+
+	fyne.Do(func() {
+		w.SetContent(
+			container.NewVBox(
+				widget.NewLabel(fmt.Sprintf("Could not reach (%v): %v\n\n"+
+					"You can browse the listings cached from earlier until it can be reached again, uploads need a restart once it can.", config.Host, err)),
+				widget.NewButton("Browse offline", sync.OnceFunc(func() { close(browseOffline) })),
+				widget.NewButton("Try again", sync.OnceFunc(func() { close(tryAgain) })),
+			),
+		)
+	})
+
+	select {
+	case <-browseOffline:
+		return true
+	case <-tryAgain:
+		return false
+	}
+}
+
+// logInWhenOnline to host with sess, an offline session, trying every offlineRetryInterval until it worked.
+func logInWhenOnline(w fyne.Window, sess *filebrowserSession, host, user, pass string) {
+	for {
+		time.Sleep(offlineRetryInterval)
+
+		online, err := loginToFilebrowser(host, user, pass)
+		if err != nil {
+			slog.Debug("still offline", "host", host, "error", err)
+			continue
+		}
+
+		sess.setToken(online.authToken())
+		slog.Info("logged in after browsing offline", "host", host)
+
+		fyne.Do(func() {
+			notify(w, notifyInfo, fmt.Sprintf("Connected to (%v) again, restart filebrowserui to upload", host))
+		})
+		return
+	}
+}
+
+func logic(w fyne.Window, state *appState) {
+	if err := state.configErr; err != nil {
+		state.configErr = nil
+		handleError(w, fmt.Errorf("WARNING configuration file error: %w", err), func() {
+			go logic(w, state)
+		})
+		return
+	}
+
+	db, writeAheadLog, err := openWAL(w)
+	if err != nil {
+		// retrying wouldn't fix a database of a newer version or locked by another instance, browse without uploads instead
+		acked := make(chan struct{})
+		handleError(w, fmt.Errorf("%w\n\nUploads are disabled until filebrowserui is restarted", err), func() { close(acked) })
+		<-acked
+	} else {
+		compactionCtx, stopCompaction := context.WithCancel(context.Background())
+		go writeAheadLog.CompactHistoryEvery(compactionCtx, time.Hour, config.historyRetention(), func(err error) {
+			slog.Error("could not compact upload history", "error", err)
+		})
+
+		if !state.setWAL(db, stopCompaction) {
 			return
 		}
 	}
 
+	offline, err := openOfflineCache(filepath.Join(config.Dir, offlineCacheFileName))
+	if err != nil {
+		slog.Warn("could not open offline cache, browsing without it", "error", err)
+	} else if !state.setOfflineCache(offline) {
+		return
+	}
+
 	// TODO: this flow should be async, not required to sync back to this function every run
 	// lock user into login loop until they login successfully.
 	var (
 		sess *filebrowserSession
-		err  error
+
+		// browsingOffline without being logged in, with the listings from the offline cache
+		browsingOffline bool
 	)
 	for {
 		sess, err = login(w)
 		if err != nil {
+			if isConnectivityError(err) && offline != nil && offline.has(offlineScope(config.Host, config.User)) {
+				if !askBrowseOffline(w, err) {
+					continue
+				}
+
+				sess, browsingOffline = &filebrowserSession{host: config.Host}, true
+				go logInWhenOnline(w, sess, config.Host, config.User, config.Pass)
+				break
+			}
+
 			acked := make(chan struct{})
 			handleError(w, err, func() { close(acked) })
 			<-acked
@@ -77,7 +452,34 @@ func logic(w fyne.Window) {
 		}
 	}
 
-	browse(w, sess)
+	var uploads *uploadManager
+	if !browsingOffline && writeAheadLog != nil {
+		uploads, err = startUploads(w, writeAheadLog, sess)
+		if err != nil {
+			acked := make(chan struct{})
+			handleError(w, err, func() { close(acked) })
+			<-acked
+		}
+	}
+
+	if uploads != nil && !state.setUploads(uploads) {
+		return
+	}
+
+	cache := NewNodeCache(sess, config.nodeCacheOptions())
+	if offline != nil {
+		if err := cache.Restore(offline, offlineScope(config.Host, config.User)); err != nil {
+			slog.Error("could not restore listings from the offline cache", "error", err)
+		}
+	}
+	revalidationCtx, stopRevalidation := context.WithCancel(context.Background())
+	go cache.RevalidateEvery(revalidationCtx, offlineRetryInterval)
+
+	if !state.setCache(cache, stopRevalidation) {
+		return
+	}
+
+	browse(w, sess, cache, uploads, &state.handOffs)
 }
 
 // TODO: make this buffer only hold a certain amount of lines
@@ -133,6 +535,30 @@ func setupLogLevel() (levelSet bool) {
 func Run() (err error) {
 	levelSet := setupLogLevel()
 
+	// the configuration directory is needed before the window, to find out if we are the only instance using it
+	state := &appState{configErr: parseConfig()}
+
+	inst, err := acquireInstance(config.Dir)
+	switch {
+	case errors.Is(err, errAlreadyRunning):
+		slog.Info("handing paths to the running instance", "paths", flag.Args())
+		return handOff(config.Dir, flag.Args())
+	case err != nil:
+		// the WAL lock still stops two instances from uploading at once
+		slog.Warn("could not take the single instance lock, paths can't be handed to this instance", "error", err)
+		inst = nil
+	default:
+		defer func() {
+			if err2 := inst.Close(); err2 != nil {
+				err = errors.Join(err, fmt.Errorf("could not close instance lock: %w", err2))
+			}
+		}()
+	}
+
+	if len(flag.Args()) > 0 {
+		state.handOffs.push(flag.Args())
+	}
+
 	a := app.NewWithID("github.com/ctII/filebrowserui")
 	w := a.NewWindow("FilebrowserUI")
 	w.Resize(fyne.NewSize(700, 400))
@@ -144,13 +570,25 @@ func Run() (err error) {
 
 		w.Canvas().AddShortcut(&debugShortcut, func(_ fyne.Shortcut) {
 			slog.Info("opening popup for debug information")
-			ShowDismissablePopup(w, logBuf.String())
+			ShowDismissablePopup(w, state.debugInfo()+"\n\n"+logBuf.String())
 		})
 	}
 
-	go logic(w)
+	if inst != nil {
+		go inst.serve(func(paths []string) error {
+			fyne.Do(w.RequestFocus)
+			if len(paths) > 0 {
+				state.handOffs.push(paths)
+			}
+			return nil
+		})
+	}
+
+	interceptQuit(a, w, state)
+
+	go logic(w, state)
 
 	w.ShowAndRun()
 
-	return nil
+	return state.close()
 }
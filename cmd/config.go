@@ -9,6 +9,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/ctII/filebrowserui/wal"
 )
 
 type Config struct {
@@ -19,6 +22,26 @@ type Config struct {
 	// Ex: https://filebrowser.clayton.coffee
 	Host string `json:"host"`
 
+	// HistoryMaxAgeDays is how long finished uploads are kept in the history, 0 uses the default and < 0 keeps them forever.
+	HistoryMaxAgeDays int `json:"historyMaxAgeDays,omitempty"`
+
+	// HistoryMaxEntries is how many finished uploads are kept in the history, 0 uses the default and < 0 keeps all of them.
+	HistoryMaxEntries int `json:"historyMaxEntries,omitempty"`
+
+	// CacheTTLSeconds is how old a cached directory listing gets before it is fetched again in the background,
+	// 0 uses the default and < 0 never fetches it again until refreshed.
+	CacheTTLSeconds int `json:"cacheTTLSeconds,omitempty"`
+
+	// CacheMaxEntries is how many directory listings are cached, 0 uses the default and < 0 caches all of them.
+	CacheMaxEntries int `json:"cacheMaxEntries,omitempty"`
+
+	// CacheMaxMiB is roughly how much memory cached directory listings may use, 0 uses the default and < 0 has no limit.
+	CacheMaxMiB int `json:"cacheMaxMiB,omitempty"`
+
+	// PrefetchDirs is how many subdirectories of an opened directory are fetched ahead of time,
+	// 0 uses the default and < 0 doesn't fetch any.
+	PrefetchDirs int `json:"prefetchDirs,omitempty"`
+
 	// Dir is the parent folder that contains our files.
 	// Ex: ~/.config/filebrowser/
 	Dir string `json:"-"`
@@ -34,11 +57,88 @@ type Config struct {
 
 var config *Config
 
+const (
+	defaultHistoryMaxAgeDays = 90
+	defaultHistoryMaxEntries = 1000
+	defaultCacheTTL          = 30 * time.Second
+	defaultCacheMaxEntries   = 2000
+	defaultCacheMaxMiB       = 64
+	defaultPrefetchDirs      = 5
+
+	// prefetchConcurrency is how many directories are fetched ahead of time at once
+	prefetchConcurrency = 2
+)
+
+// nodeCacheOptions of the NodeCache, applying defaults for unset fields.
+func (c *Config) nodeCacheOptions() NodeCacheOptions {
+	var opts NodeCacheOptions
+
+	switch {
+	case c.CacheTTLSeconds == 0:
+		opts.TTL = defaultCacheTTL
+	case c.CacheTTLSeconds > 0:
+		opts.TTL = time.Duration(c.CacheTTLSeconds) * time.Second
+	}
+
+	switch {
+	case c.CacheMaxEntries == 0:
+		opts.MaxEntries = defaultCacheMaxEntries
+	case c.CacheMaxEntries > 0:
+		opts.MaxEntries = c.CacheMaxEntries
+	}
+
+	switch {
+	case c.CacheMaxMiB == 0:
+		opts.MaxBytes = defaultCacheMaxMiB << 20
+	case c.CacheMaxMiB > 0:
+		opts.MaxBytes = int64(c.CacheMaxMiB) << 20
+	}
+
+	switch {
+	case c.PrefetchDirs == 0:
+		opts.Prefetch = defaultPrefetchDirs
+	case c.PrefetchDirs > 0:
+		opts.Prefetch = c.PrefetchDirs
+	}
+	opts.PrefetchConcurrency = prefetchConcurrency
+
+	return opts
+}
+
+// historyRetention of finished uploads in the WAL, applying defaults for unset fields.
+func (c *Config) historyRetention() wal.Retention {
+	var retention wal.Retention
+
+	switch {
+	case c.HistoryMaxAgeDays == 0:
+		retention.MaxAge = defaultHistoryMaxAgeDays * 24 * time.Hour
+	case c.HistoryMaxAgeDays > 0:
+		retention.MaxAge = time.Duration(c.HistoryMaxAgeDays) * 24 * time.Hour
+	}
+
+	switch {
+	case c.HistoryMaxEntries == 0:
+		retention.MaxEntries = defaultHistoryMaxEntries
+	case c.HistoryMaxEntries > 0:
+		retention.MaxEntries = c.HistoryMaxEntries
+	}
+
+	return retention
+}
+
 func GetConfig() *Config {
 	return config
 }
 
-const configFileName = "config.json"
+const (
+	configFileName = "config.json"
+
+	// walFileName is the bbolt database holding the write ahead log of uploads, inside of Config.Dir.
+	walFileName = "wal.db"
+
+	// offlineCacheFileName is the bbolt database holding directory listings for browsing offline, inside of Config.Dir.
+	offlineCacheFileName = "cache.db"
+)
 
 func parseConfigPath(path string) error {
 	// #nosec G304 -- we want to include the filepath, since it is a configuration file
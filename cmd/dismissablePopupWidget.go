@@ -9,6 +9,11 @@ import (
 )
 
 func ShowDismissablePopup(window fyne.Window, msg string) {
+	showDismissablePopup(window, msg, func() {})
+}
+
+// showDismissablePopup of msg over window, calling dismissed once the user hits "Okay".
+func showDismissablePopup(window fyne.Window, msg string, dismissed func()) {
 	once := sync.Once{}
 
 	var modal *widget.PopUp
@@ -24,7 +29,10 @@ func ShowDismissablePopup(window fyne.Window, msg string) {
 			window.Clipboard().SetContent(msg)
 		}),
 		widget.NewButton("Okay", func() {
-			once.Do(modal.Hide)
+			once.Do(func() {
+				modal.Hide()
+				dismissed()
+			})
 		}),
 	)
 
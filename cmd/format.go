@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+)
+
+// formatBytes n using IEC units, ex: 1536 = "1.50 KiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.2f %v", value, units[i])
+}
+
+// formatBytesSI n using SI units, ex: 1500 = "1.50 kB"
+func formatBytesSI(n int64) string {
+	const unit = 1000
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value := float64(n)
+	units := []string{"kB", "MB", "GB", "TB", "PB", "EB"}
+
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.2f %v", value, units[i])
+}
+
+// formatSize n in IEC and SI units and exactly, ex: 1536 = "1.50 KiB (1.54 kB, 1,536 bytes)"
+func formatSize(n int64) string {
+	if n < 1000 && n > -1000 {
+		return formatCount(int(n), "byte", "bytes")
+	}
+	return fmt.Sprintf("%v (%v, %v bytes)", formatBytes(n), formatBytesSI(n), formatThousands(n))
+}
+
+// formatThousands n with its thousands separated by commas, ex: 1234567 = "1,234,567"
+func formatThousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+
+	return sign + s
+}
+
+// formatTimestamp t in local time and relative to now, ex: "2024-06-01 14:00:00 (3 days ago)"
+func formatTimestamp(t, now time.Time) string {
+	return fmt.Sprintf("%v (%v)", t.Local().Format(time.DateTime), formatRelative(t, now))
+}
+
+// formatMode as a Unix mode string with its permission bits in octal, ex: "-rw-r--r-- (0644)"
+func formatMode(mode fs.FileMode) string {
+	return fmt.Sprintf("%v (%04o)", mode, mode.Perm())
+}
+
+// formatRelative time t to now, ex: "5 minutes ago" or "in 2 days"
+func formatRelative(t, now time.Time) string {
+	const day = 24 * time.Hour
+
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		s = formatCount(int(d/time.Minute), "minute", "minutes")
+	case d < day:
+		s = formatCount(int(d/time.Hour), "hour", "hours")
+	case d < 30*day:
+		s = formatCount(int(d/day), "day", "days")
+	case d < 365*day:
+		s = formatCount(int(d/(30*day)), "month", "months")
+	default:
+		s = formatCount(int(d/(365*day)), "year", "years")
+	}
+
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// formatCount n of a unit named singular, or plural for any other count than 1, ex: "1 file" or "3 files"
+func formatCount(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %v", n, plural)
+}
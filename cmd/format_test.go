@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1024:      "1.00 KiB",
+		1536:      "1.50 KiB",
+		5 << 20:   "5.00 MiB",
+		3 << 30:   "3.00 GiB",
+		-2048:     "-2.00 KiB",
+		1<<62 + 1: "4.00 EiB",
+	}
+
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%v) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0 directories"},
+		{1, "1 directory"},
+		{2, "2 directories"},
+		{1500, "1500 directories"},
+	}
+
+	for _, test := range tests {
+		if got := formatCount(test.n, "directory", "directories"); got != test.want {
+			t.Errorf("formatCount(%v) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestFormatRelative(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[time.Duration]string{
+		0:                     "just now",
+		59 * time.Second:      "just now",
+		time.Minute:           "1 minute ago",
+		90 * time.Minute:      "1 hour ago",
+		5 * time.Hour:         "5 hours ago",
+		3 * 24 * time.Hour:    "3 days ago",
+		65 * 24 * time.Hour:   "2 months ago",
+		800 * 24 * time.Hour:  "2 years ago",
+		-2 * 24 * time.Hour:   "in 2 days",
+		-10 * time.Minute:     "in 10 minutes",
+		-30 * time.Second:     "just now",
+		-400 * 24 * time.Hour: "in 1 year",
+	}
+
+	for ago, want := range tests {
+		if got := formatRelative(now.Add(-ago), now); got != want {
+			t.Errorf("formatRelative(%v ago) = %v, want %v", ago, got, want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	t.Parallel()
+
+	tests := map[int64]string{
+		0:       "0 bytes",
+		1:       "1 byte",
+		999:     "999 bytes",
+		1000:    "1000 B (1.00 kB, 1,000 bytes)",
+		1536:    "1.50 KiB (1.54 kB, 1,536 bytes)",
+		5 << 20: "5.00 MiB (5.24 MB, 5,242,880 bytes)",
+	}
+
+	for n, want := range tests {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%v) = %v, want %v", n, got, want)
+		}
+	}
+
+	if got := formatThousands(-1234567); got != "-1,234,567" {
+		t.Errorf("formatThousands(-1234567) = %v, want -1,234,567", got)
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	t.Parallel()
+
+	tests := map[fs.FileMode]string{
+		0o644:                  "-rw-r--r-- (0644)",
+		fs.ModeDir | 0o755:     "drwxr-xr-x (0755)",
+		fs.ModeSymlink | 0o777: "Lrwxrwxrwx (0777)",
+	}
+
+	for mode, want := range tests {
+		if got := formatMode(mode); got != want {
+			t.Errorf("formatMode(%v) = %v, want %v", uint32(mode), got, want)
+		}
+	}
+}
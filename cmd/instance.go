@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+
+internal documention:
+
+Only one filebrowserui may use a configuration directory at a time, since the WAL and config file would be fought over.
+The first instance takes an exclusive lock on instanceLockFileName and listens on the unix socket instanceSocketFileName,
+both inside of Config.Dir. A later instance that can't take the lock sends the paths it was started with over the socket
+as one JSON handOffRequest, the first instance answers with one handOffResponse and hands the paths to its upload flow.
+
+The lock is what decides who owns the directory, the socket file is removed and recreated by the owner,
+so one left behind by a crash doesn't matter.
+
+*/
+
+const (
+	instanceLockFileName   = "instance.lock"
+	instanceSocketFileName = "instance.sock"
+
+	// handOffTimeout of a connection to the running instance.
+	handOffTimeout = 5 * time.Second
+)
+
+// errAlreadyRunning is returned by acquireInstance when another instance holds the lock.
+var errAlreadyRunning = errors.New("filebrowserui is already running with this configuration directory")
+
+// handOffRequest sent by a second instance to the running one.
+type handOffRequest struct {
+	// Paths to upload, absolute since the running instance has a different working directory.
+	// No paths only asks the running instance to show itself.
+	Paths []string `json:"paths"`
+}
+
+// handOffResponse of the running instance.
+type handOffResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// instance is the lock and hand off socket of the instance owning a configuration directory.
+type instance struct {
+	lock     *os.File
+	listener net.Listener
+
+	// connections being handled, Close waits on them
+	connections sync.WaitGroup
+}
+
+// acquireInstance of the configuration directory dir, returning errAlreadyRunning if another instance has it.
+func acquireInstance(dir string) (*instance, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("could not create configuration directory (%v): %w", dir, err)
+	}
+
+	lockPath := filepath.Join(dir, instanceLockFileName)
+
+	// #nosec G304 -- the lock file is in our configuration directory
+	lock, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open instance lock (%v): %w", lockPath, err)
+	}
+
+	if err := lockFile(lock); err != nil {
+		return nil, errors.Join(err, lock.Close())
+	}
+
+	socketPath := filepath.Join(dir, instanceSocketFileName)
+
+	// we own the directory, so a socket file is one left behind by an instance that crashed
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Join(fmt.Errorf("could not remove stale instance socket (%v): %w", socketPath, err), lock.Close())
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("could not listen on instance socket (%v): %w", socketPath, err), lock.Close())
+	}
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return nil, errors.Join(fmt.Errorf("could not restrict permissions of instance socket (%v): %w", socketPath, err), listener.Close(), lock.Close())
+	}
+
+	return &instance{lock: lock, listener: listener}, nil
+}
+
+// serve hand off requests until Close, calling handle with the paths of each request.
+func (i *instance) serve(handle func(paths []string) error) {
+	for {
+		conn, err := i.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("could not accept instance connection", "error", err)
+			}
+			return
+		}
+
+		i.connections.Add(1)
+		go func() {
+			defer i.connections.Done()
+
+			if err := serveHandOff(conn, handle); err != nil {
+				slog.Error("could not handle paths from another instance", "error", err)
+			}
+		}()
+	}
+}
+
+// serveHandOff of a single connection.
+func serveHandOff(conn net.Conn, handle func(paths []string) error) (err error) {
+	defer func() {
+		if err2 := conn.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close connection: %w", err2))
+		}
+	}()
+
+	if err := conn.SetDeadline(time.Now().Add(handOffTimeout)); err != nil {
+		return fmt.Errorf("could not set connection deadline: %w", err)
+	}
+
+	var req handOffRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return fmt.Errorf("could not decode hand off request: %w", err)
+	}
+
+	var resp handOffResponse
+	if err := handle(req.Paths); err != nil {
+		resp.Error = err.Error()
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		return fmt.Errorf("could not encode hand off response: %w", err)
+	}
+
+	return nil
+}
+
+// Close the socket and release the lock, waiting for connections being handled.
+func (i *instance) Close() error {
+	err := i.listener.Close()
+	i.connections.Wait()
+
+	if err2 := i.lock.Close(); err2 != nil {
+		err = errors.Join(err, fmt.Errorf("could not close instance lock: %w", err2))
+	}
+
+	return err
+}
+
+// handOff paths to the instance running with the configuration directory dir.
+func handOff(dir string, paths []string) error {
+	req := handOffRequest{Paths: make([]string, 0, len(paths))}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("could not get absolute path of (%v): %w", p, err)
+		}
+		req.Paths = append(req.Paths, abs)
+	}
+
+	socketPath := filepath.Join(dir, instanceSocketFileName)
+
+	conn, err := net.DialTimeout("unix", socketPath, handOffTimeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to the running instance (%v): %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(handOffTimeout)); err != nil {
+		return fmt.Errorf("could not set connection deadline: %w", err)
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("could not send paths to the running instance: %w", err)
+	}
+
+	var resp handOffResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("could not read response of the running instance: %w", err)
+	}
+
+	if resp.Error != "" {
+		return fmt.Errorf("running instance could not take the paths: %v", resp.Error)
+	}
+
+	return nil
+}
+
+// handOffQueue holds paths handed to this instance until the upload flow is ready for them.
+type handOffQueue struct {
+	mu      sync.Mutex
+	pending [][]string
+	handler func(paths []string)
+}
+
+// push paths to the handler, or hold them until there is one.
+func (h *handOffQueue) push(paths []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.handler == nil {
+		h.pending = append(h.pending, paths)
+		return
+	}
+
+	h.handler(paths)
+}
+
+// setHandler of the paths, passing it every path held until now.
+func (h *handOffQueue) setHandler(handler func(paths []string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.handler = handler
+
+	for _, paths := range h.pending {
+		handler(paths)
+	}
+	h.pending = nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package cmd
+
+import "os"
+
+// lockFile does nothing on platforms without file locks, the WAL database still can't be opened twice.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInstanceHandOff(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	inst, err := acquireInstance(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := acquireInstance(dir); !errors.Is(err, errAlreadyRunning) {
+		t.Fatalf("expected errAlreadyRunning while the lock is held, got (%v)", err)
+	}
+
+	received := make(chan []string, 1)
+	go inst.serve(func(paths []string) error {
+		received <- paths
+		return nil
+	})
+
+	paths := []string{"a.txt", filepath.Join("dir", "b")}
+	if err := handOff(dir, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-received
+	for i := range paths {
+		abs, err := filepath.Abs(paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Contains(got, abs) {
+			t.Fatalf("expected absolute path (%v) to be handed off, got %v", abs, got)
+		}
+	}
+
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new instance can take over the directory, including the socket file left behind
+	inst, err = acquireInstance(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandOffQueue(t *testing.T) {
+	t.Parallel()
+
+	var h handOffQueue
+	h.push([]string{"a"})
+	h.push([]string{"b"})
+
+	var got []string
+	h.setHandler(func(paths []string) { got = append(got, paths...) })
+	h.push([]string{"c"})
+
+	if !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("expected paths in order they were pushed, got %v", got)
+	}
+}
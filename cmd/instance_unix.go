@@ -0,0 +1,23 @@
+//go:build unix
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile f exclusively without blocking, returning errAlreadyRunning if another process has it.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) // #nosec G115 -- file descriptors fit in an int
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errAlreadyRunning
+	}
+	if err != nil {
+		return fmt.Errorf("could not lock (%v): %w", f.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile f exclusively without blocking, returning errAlreadyRunning if another process has it.
+func lockFile(f *os.File) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errAlreadyRunning
+	}
+	if err != nil {
+		return fmt.Errorf("could not lock (%v): %w", f.Name(), err)
+	}
+
+	return nil
+}
@@ -7,119 +7,439 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
-func browse(w fyne.Window, sess *filebrowserSession) {
-	cache := NewNodeCache(sess)
+// browse the filebrowser of sess, uploads is nil if the upload manager could not be started.
+// Paths from handOffs are uploaded into the selected directory.
+func browse(w fyne.Window, sess *filebrowserSession, cache *NodeCache, uploads *uploadManager, handOffs *handOffQueue) {
 
-	fileInfo := widget.NewLabel("")
+	// selectedDir is the directory of the selected node, only used on the fyne goroutine
+	selectedDir := "/"
+	selectedID, selected := "", false
 
-	tree := widget.NewTree(
-		func(id widget.TreeNodeID) []widget.TreeNodeID {
-			res, err := cache.Info(context.Background(), id)
-			if err != nil {
-				handleError(w, err, func() {})
-				return []string{}
-			}
+	// rows rendered by the tree and the node they show, to find the node under a drop. only used on the fyne goroutine
+	rows := make(map[fyne.CanvasObject]treeRow)
 
-			if !res.IsDir {
-				slog.Error("Logic error, we have a file in the path instead of a directory for a branch")
-			}
+	props := newPropertiesPane(sess, cache, func(err error) { notify(w, notifyError, err.Error()) })
 
-			leaves := make([]string, 0, len(res.Items))
+	// status of the connection to filebrowser
+	status := widget.NewLabel("")
+	updateStatus := func() {
+		if cache.Offline() {
+			status.Importance = widget.WarningImportance
+			status.SetText("Offline, showing cached listings")
+			return
+		}
+		if !sess.can(permCreate) {
+			status.Importance = widget.MediumImportance
+			status.SetText("Read-only, filebrowser doesn't allow uploading")
+			return
+		}
+		status.SetText("")
+	}
 
-			for i := range res.Items {
-				leaves = append(leaves, res.Items[i].Path)
-			}
+	var tree *keyTree
+	var bar *pathBar
+	var menu *nodeMenu
 
-			return leaves
-		},
-		func(id widget.TreeNodeID) bool {
-			res, err := cache.Info(context.Background(), id)
-			if err != nil {
-				handleError(w, err, func() {})
-				return false
-			}
+	// revealing is the node selected by reveal, scrolled to once its parent is loaded
+	revealing := ""
 
-			return res.IsDir
-		},
-		func(branch bool) fyne.CanvasObject {
-			if branch {
-				return widget.NewLabel("Branch template")
-			}
+	// list shows the selected directory instead of the tree while listView is true
+	var list *dirList
+	listView := false
 
+	var loader *treeLoader
+	loader = newTreeLoader(cache, false, func(id widget.TreeNodeID) {
+		tree.RefreshItem(id)
+		updateStatus()
+		if revealing != "" && loader.loaded(treeParentID(revealing)) {
+			tree.ScrollTo(revealing)
+			revealing = ""
+		}
+		if listView {
+			list.load(selectedDir)
+		}
+	})
+
+	tree = newKeyTree(
+		loader.children,
+		loader.isBranch,
+		func(branch bool) fyne.CanvasObject {
 			return NewNodeWidget()
 		},
 		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			rows[o] = treeRow{id: id, branch: branch}
+			nw := o.(*nodeWidget)
+
 			text := path.Base(strings.ReplaceAll(id, "\n", "\\n"))
 
 			if branch {
-				o.(*widget.Label).SetText(text)
+				switch freshness, fetched := cache.Freshness(id); freshness {
+				case nodeRestored:
+					text += " (cached " + formatRelative(fetched, time.Now()) + ")"
+				case nodeOffline:
+					text += " (offline, from " + formatRelative(fetched, time.Now()) + ")"
+				}
+
+				nw.SetLabel(text)
+				nw.SetButton("", false)
+				nw.SetMenuFunc(func(ev *fyne.PointEvent) { menu.show(id, true, ev.AbsolutePosition) })
 				return
 			}
 
-			o.(*nodeWidget).SetLabel(text)
-			o.(*nodeWidget).SetButtonFunc(func() {
-				sum, err := sess.SHA256(context.Background(), id)
-				if err != nil {
-					ShowDismissablePopup(w, err.Error())
+			if parent, isError, ok := treePlaceholder(id); ok {
+				nw.SetMenuFunc(nil)
+
+				if !isError {
+					nw.SetLabel("loading…")
+					nw.SetButton("", false)
 					return
 				}
 
-				ShowDismissablePopup(w, sum)
-			})
+				nw.SetLabel("could not load: " + loader.errText(parent))
+				nw.SetButton("Retry", true)
+				nw.SetButtonFunc(func() { loader.reload(parent) })
+				return
+			}
+
+			nw.SetLabel(text)
+			nw.SetButton("Checksum", true)
+			nw.SetButtonFunc(func() { menu.checksum(id, false) })
+			nw.SetMenuFunc(func(ev *fyne.PointEvent) { menu.show(id, false, ev.AbsolutePosition) })
 		},
 	)
 
+	tree.OnBranchOpened = loader.opened
+	tree.OnBranchClosed = loader.closed
+	// the root is always shown open
+	loader.opened(tree.Root)
+
+	// cancelSelected stops loading the info of the previous selection
+	cancelSelected := func() {}
+
 	tree.OnSelected = func(id widget.TreeNodeID) {
-		res, err := cache.Info(context.Background(), id)
-		if err != nil {
-			handleError(w, err, func() {})
+		cancelSelected()
+
+		if _, _, ok := treePlaceholder(id); ok {
+			tree.Unselect(id)
+			return
+		}
+		selectedID, selected = id, true
+		if id != revealing {
+			revealing = ""
+		}
+
+		// revealed directories are opened before their parent is loaded and known to be a directory
+		isDir := loader.isBranch(id) || tree.IsBranchOpen(id)
+		if isDir {
+			selectedDir = treeRow{id: id, branch: true}.dir()
+		} else {
+			selectedDir = path.Dir(id)
+		}
+
+		bar.setPath(path.Clean("/" + id))
+
+		if listView && list.dir != selectedDir {
+			list.load(selectedDir)
+		}
+
+		props.setText("Loading…")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelSelected = cancel
+
+		go func() {
+			defer cancel()
+
+			res, err := cache.Info(ctx, id)
+
+			// waiting, so ctx is only cancelled by the deferred cancel once it was checked
+			fyne.DoAndWait(func() {
+				if ctx.Err() != nil {
+					return
+				}
+
+				if err != nil {
+					slog.Error("could not get info of selected node", "path", id, "error", err)
+					props.setText(fmt.Sprintf("could not get info of (%v): %v", strings.ReplaceAll(id, "\n", "\\n"), err))
+					return
+				}
+
+				props.show(res)
+			})
+		}()
+	}
+
+	// reveal the remote path p in the tree, opening the branches down to it and selecting it
+	reveal := func(p string) {
+		go func() {
+			res, err := cache.Info(context.Background(), p)
+
+			fyne.DoAndWait(func() {
+				if err != nil {
+					notify(w, notifyError, fmt.Sprintf("could not open (%v): %v", strings.ReplaceAll(p, "\n", "\\n"), err))
+					return
+				}
+
+				if p == "/" {
+					tree.Select(tree.Root)
+					return
+				}
+
+				for _, crumb := range breadcrumbs(path.Dir(p))[1:] {
+					tree.OpenBranch(crumb.path)
+				}
+				if res.IsDir {
+					tree.OpenBranch(p)
+				}
+
+				revealing = p
+				tree.Select(p)
+
+				if loader.loaded(treeParentID(p)) {
+					tree.ScrollTo(p)
+					revealing = ""
+				}
+			})
+		}()
+	}
+
+	bar = newPathBar(w, cache, reveal)
+
+	menu = &nodeMenu{w: w, sess: sess, cache: cache, checksummed: props.checksummed, changed: func(dirs ...string) {
+		for _, dir := range dirs {
+			loader.refreshTree(dir)
+		}
+	}}
+
+	list = newDirList(w, cache, func(p string, isDir bool) {
+		// rows deeper than the tree loaded aren't known to be directories by it yet
+		loader.setDir(p, isDir)
+		tree.Select(p)
+	})
+	list.table.Hide()
+
+	layoutButton := widget.NewButtonWithIcon("List view", theme.ListIcon(), nil)
+	layoutButton.OnTapped = func() {
+		listView = !listView
+
+		if listView {
+			tree.Hide()
+			list.table.Show()
+			list.load(selectedDir)
+			layoutButton.SetText("Tree view")
 			return
 		}
 
-		if res.IsDir {
-			fileInfo.SetText(fmt.Sprintf("Name: %v\nModified: %v",
-				strings.ReplaceAll(res.Name, "\n", "\\n"),
-				res.Modified,
-			))
+		list.cancel()
+		list.table.Hide()
+		tree.Show()
+		layoutButton.SetText("List view")
+	}
+
+	split := container.NewHSplit(container.NewStack(tree, list.table), props.content)
+	split.Offset = 0.6
+
+	priorityLayout := container.New(&priorityVLayout{}, split, newNotificationsPanel(w))
+
+	historyButton := widget.NewButton("History", func() {
+		showHistory(fyne.CurrentApp(), uploads.wal)
+	})
+	if uploads == nil {
+		historyButton.Disable()
+	}
+
+	// refresh the selected directory and every loaded directory below it
+	refresh := func() {
+		loader.refreshTree(selectedDir)
+		if listView {
+			list.load(selectedDir)
+		}
+		if selected {
+			tree.OnSelected(selectedID)
+		}
+	}
+
+	tree.onKey = func(ev *fyne.KeyEvent) bool {
+		if ev.Name == fyne.KeyF5 {
+			refresh()
+			return true
+		}
+		return false
+	}
+
+	refreshButton := widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), refresh)
+
+	uploadButton := widget.NewButton("Upload", func() {
+		showUploadDialog(fyne.CurrentApp(), sess, cache, uploads, selectedDir, nil)
+	})
+	updateUploadButton := func() {
+		if uploads == nil || !sess.can(permCreate) {
+			uploadButton.Disable()
 		} else {
-			// TODO: dynamically change size unit
-			fileInfo.SetText(fmt.Sprintf("Name: %v\nModified: %v\nSize: %.2f MB",
-				strings.ReplaceAll(res.Name, "\n", "\\n"),
-				res.Modified,
-				float64(res.Size)/float64(1024)/float64(1024)),
-			)
+			uploadButton.Enable()
 		}
 	}
+	updateUploadButton()
+
+	// the user and their permissions change when an offline session logs in
+	sess.OnTokenChanged(func() {
+		fyne.Do(func() {
+			updateStatus()
+			updateUploadButton()
+		})
+	})
+
+	transfersButton := widget.NewButton("Transfers", func() {
+		showTransfers(fyne.CurrentApp(), uploads)
+	})
+	if uploads == nil {
+		transfersButton.Disable()
+	}
+
+	topBar := container.NewBorder(nil, nil, container.NewHBox(uploadButton, refreshButton, layoutButton), container.NewHBox(transfersButton, historyButton), status)
+
+	border := container.NewBorder(container.NewVBox(topBar, bar.bar), nil, nil, nil, priorityLayout)
+
+	fyne.DoAndWait(func() { w.SetContent(withToasts(w, border)) })
+
+	fyne.Do(func() {
+		// F5 while nothing has focus, the tree handles it while it does
+		w.Canvas().SetOnTypedKey(func(ev *fyne.KeyEvent) { tree.onKey(ev) })
 
-	priorityLayout := container.New(&priorityVLayout{}, tree, fileInfo)
+		w.Canvas().AddShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyL, Modifier: fyne.KeyModifierShortcutDefault}, func(_ fyne.Shortcut) {
+			bar.edit()
+		})
 
-	border := container.NewBorder(widget.NewButton("Upload", func() {}), nil, nil, nil, priorityLayout)
+		w.SetOnDropped(func(pos fyne.Position, uris []fyne.URI) {
+			paths := make([]string, 0, len(uris))
+			for _, uri := range uris {
+				if uri.Scheme() != "file" {
+					slog.Info("ignoring dropped item that is not a local file", "uri", uri.String())
+					continue
+				}
+				paths = append(paths, uri.Path())
+			}
+
+			if len(paths) == 0 {
+				return
+			}
+
+			if uploads == nil {
+				notify(w, notifyError, fmt.Sprintf("could not upload (%v), uploads are not available", strings.Join(paths, ", ")))
+				return
+			}
 
-	fyne.DoAndWait(func() { w.SetContent(border) })
+			dir := selectedDir
+			if row, ok := rowAt(&tree.Tree, rows, pos); ok {
+				dir = row.dir()
+			}
+
+			confirmDroppedUpload(w, uploads, dir, paths)
+		})
+	})
+
+	handOffs.setHandler(func(paths []string) {
+		fyne.Do(func() {
+			if uploads == nil {
+				notify(w, notifyError, fmt.Sprintf("could not upload (%v), uploads are not available", strings.Join(paths, ", ")))
+				return
+			}
+
+			// the paths come from outside of the window, where they go and what happens to conflicts is up to the user
+			showUploadDialog(fyne.CurrentApp(), sess, cache, uploads, selectedDir, paths)
+		})
+	})
 }
 
-// handleError on window with err and call f after user hits "Okay" button.
-func handleError(w fyne.Window, err error, okay func()) {
-	once := sync.Once{}
-
-	w.SetContent(
-		container.NewVBox(
-			widget.NewLabel(err.Error()),
-			widget.NewButton("Copy Error", func() {
-				w.Clipboard().SetContent(err.Error())
-			}),
-			widget.NewButton("Okay", func() {
-				once.Do(okay)
-			}),
-		),
-	)
+// keyTree is a widget.Tree that offers the keys it doesn't handle itself, like F5, to onKey first.
+type keyTree struct {
+	widget.Tree
+
+	// onKey returns true if it handled ev
+	onKey func(ev *fyne.KeyEvent) bool
+}
+
+func newKeyTree(
+	childUIDs func(widget.TreeNodeID) []widget.TreeNodeID,
+	isBranch func(widget.TreeNodeID) bool,
+	create func(bool) fyne.CanvasObject,
+	update func(widget.TreeNodeID, bool, fyne.CanvasObject),
+) *keyTree {
+	t := &keyTree{Tree: widget.Tree{ChildUIDs: childUIDs, IsBranch: isBranch, CreateNode: create, UpdateNode: update}}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+func (t *keyTree) TypedKey(ev *fyne.KeyEvent) {
+	if t.onKey != nil && t.onKey(ev) {
+		return
+	}
+	t.Tree.TypedKey(ev)
+}
+
+// treeParentID is the id of the branch showing the node id.
+func treeParentID(id widget.TreeNodeID) widget.TreeNodeID {
+	parent := path.Dir(id)
+	if parent == "/" {
+		return ""
+	}
+	return parent
+}
+
+// treeRow is the node shown by a row of the tree.
+type treeRow struct {
+	id     widget.TreeNodeID
+	branch bool
+}
+
+// dir of the row, the node itself for branches and its parent for leaves.
+// Placeholders shown while a branch loads belong to that branch.
+func (r treeRow) dir() string {
+	if branch, _, ok := treePlaceholder(r.id); ok {
+		return treeRow{id: branch, branch: true}.dir()
+	}
+
+	if r.branch {
+		if r.id == "" {
+			return "/"
+		}
+		return r.id
+	}
+	return path.Dir(r.id)
+}
+
+// rowAt pos of the canvas in tree, if a visible row is there.
+func rowAt(tree *widget.Tree, rows map[fyne.CanvasObject]treeRow, pos fyne.Position) (treeRow, bool) {
+	driver := fyne.CurrentApp().Driver()
+
+	contains := func(o fyne.CanvasObject) bool {
+		topLeft := driver.AbsolutePositionForObject(o)
+		bottomRight := topLeft.Add(o.Size())
+		return pos.X >= topLeft.X && pos.Y >= topLeft.Y && pos.X < bottomRight.X && pos.Y < bottomRight.Y
+	}
+
+	// rows scrolled out of the tree are still positioned, just clipped
+	if !tree.Visible() || !contains(tree) {
+		return treeRow{}, false
+	}
+
+	for o, row := range rows {
+		if o.Visible() && contains(o) {
+			return row, true
+		}
+	}
+
+	return treeRow{}, false
 }
 
 func login(w fyne.Window) (sess *filebrowserSession, err error) {
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ctII/filebrowserui/wal"
+)
+
+var historyColumns = []struct {
+	title string
+	width float32
+	value func(wal.HistoryEntry) string
+}{
+	{"Finished", 150, func(e wal.HistoryEntry) string { return e.Finished.Local().Format(time.DateTime) }},
+	{"Destination", 200, func(e wal.HistoryEntry) string { return strings.ReplaceAll(e.Destination, "\n", "\\n") }},
+	{"Files", 60, func(e wal.HistoryEntry) string { return strconv.Itoa(e.Files) }},
+	{"Size", 90, func(e wal.HistoryEntry) string { return formatBytes(e.Bytes) }},
+	{"Skipped", 70, func(e wal.HistoryEntry) string { return strconv.Itoa(e.Skipped) }},
+	{"Duration", 90, func(e wal.HistoryEntry) string { return e.Duration.Round(time.Second).String() }},
+	{"Failures", 70, func(e wal.HistoryEntry) string { return strconv.Itoa(e.Failures) }},
+	{"Unfinished", 80, func(e wal.HistoryEntry) string { return strconv.Itoa(e.Unfinished) }},
+}
+
+// showHistory of finished upload batches in a new window, filterable by destination and failures.
+func showHistory(a fyne.App, writeAheadLog *wal.WriteAheadLog) {
+	w := a.NewWindow("Upload History")
+	w.Resize(fyne.NewSize(920, 400))
+
+	var entries []wal.HistoryEntry
+
+	table := widget.NewTable(
+		func() (int, int) { return len(entries), len(historyColumns) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			if id.Row >= len(entries) {
+				return
+			}
+			o.(*widget.Label).SetText(historyColumns[id.Col].value(entries[id.Row]))
+		},
+	)
+	table.ShowHeaderRow = true
+	table.CreateHeader = func() fyne.CanvasObject { return widget.NewLabel("") }
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		if id.Col >= 0 {
+			o.(*widget.Label).SetText(historyColumns[id.Col].title)
+		}
+	}
+	for i := range historyColumns {
+		table.SetColumnWidth(i, historyColumns[i].width)
+	}
+
+	status := widget.NewLabel("")
+
+	destination := widget.NewEntry()
+	destination.SetPlaceHolder("Destination starts with")
+	failedOnly := widget.NewCheck("Failed only", nil)
+
+	load := func() {
+		filter := wal.HistoryFilter{
+			Destination: destination.Text,
+			FailedOnly:  failedOnly.Checked,
+		}
+
+		go func() {
+			list, err := writeAheadLog.History(filter)
+			if err != nil {
+				slog.Error("could not load upload history", "error", err)
+			}
+
+			fyne.Do(func() {
+				if err != nil {
+					status.SetText(err.Error())
+					return
+				}
+
+				entries = list
+				status.SetText(fmt.Sprintf("%v finished uploads", len(entries)))
+				table.Refresh()
+			})
+		}()
+	}
+
+	destination.OnSubmitted = func(string) { load() }
+	failedOnly.OnChanged = func(bool) { load() }
+
+	filters := container.NewBorder(nil, nil, nil,
+		container.NewHBox(failedOnly, widget.NewButton("Refresh", load)),
+		destination,
+	)
+
+	w.SetContent(container.NewBorder(filters, status, nil, nil, table))
+	w.Show()
+
+	load()
+}
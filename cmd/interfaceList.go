@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// listColumn of the list view of a directory.
+type listColumn int
+
+const (
+	listColumnName listColumn = iota
+	listColumnSize
+	listColumnType
+	listColumnExtension
+	listColumnModified
+	listColumnMode
+)
+
+// listColumns in the order they're shown, with their title and width.
+var listColumns = []struct {
+	title string
+	width float32
+}{
+	listColumnName:      {"Name", 280},
+	listColumnSize:      {"Size", 100},
+	listColumnType:      {"Type", 90},
+	listColumnExtension: {"Extension", 90},
+	listColumnModified:  {"Modified", 160},
+	listColumnMode:      {"Mode", 110},
+}
+
+// listSort is the column a listing is sorted by.
+type listSort struct {
+	column listColumn
+	asc    bool
+}
+
+// defaultListSort of res, the sorting of its owner in filebrowser.
+func defaultListSort(res *Resource) listSort {
+	switch res.Sorting.By {
+	case "size":
+		return listSort{column: listColumnSize, asc: res.Sorting.Asc}
+	case "modified":
+		return listSort{column: listColumnModified, asc: res.Sorting.Asc}
+	case "name":
+		return listSort{column: listColumnName, asc: res.Sorting.Asc}
+	}
+	return listSort{column: listColumnName, asc: true}
+}
+
+// sortListItems by s, directories always before files and by name where s doesn't tell them apart.
+func sortListItems(items []ResourceItem, s listSort) {
+	byName := func(a, b ResourceItem) int {
+		return cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.Name, b.Name))
+	}
+
+	slices.SortStableFunc(items, func(a, b ResourceItem) int {
+		if a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+
+		var c int
+		switch s.column {
+		case listColumnSize:
+			c = cmp.Compare(a.Size, b.Size)
+		case listColumnType:
+			c = cmp.Compare(listCell(a, listColumnType), listCell(b, listColumnType))
+		case listColumnExtension:
+			c = cmp.Compare(strings.ToLower(a.Extension), strings.ToLower(b.Extension))
+		case listColumnModified:
+			c = a.Modified.Compare(b.Modified)
+		case listColumnMode:
+			c = cmp.Compare(a.Mode, b.Mode)
+		}
+		c = cmp.Or(c, byName(a, b))
+
+		if !s.asc {
+			return -c
+		}
+		return c
+	})
+}
+
+// listCell is the text of column for item.
+func listCell(item ResourceItem, column listColumn) string {
+	switch column {
+	case listColumnName:
+		return strings.ReplaceAll(item.Name, "\n", "\\n")
+	case listColumnSize:
+		if item.IsDir {
+			return ""
+		}
+		return formatBytes(int64(item.Size))
+	case listColumnType:
+		if item.IsDir {
+			return "directory"
+		}
+		return item.Type
+	case listColumnExtension:
+		return item.Extension
+	case listColumnModified:
+		return item.Modified.Local().Format(time.DateTime)
+	case listColumnMode:
+		return fs.FileMode(item.Mode).String()
+	}
+	return ""
+}
+
+// dirList shows the listing of a directory in a table, a row per item sortable by any column.
+// Only used on the fyne goroutine.
+type dirList struct {
+	w     fyne.Window
+	table *widget.Table
+	cache *NodeCache
+
+	// dir listed, its listing and its items, sorted by sort
+	dir   string
+	res   *Resource
+	items []ResourceItem
+	sort  listSort
+
+	// sorted is true once the user chose the sorting, otherwise the sorting of every listing is used
+	sorted bool
+
+	// cancel loading the listing of dir
+	cancel context.CancelFunc
+
+	// onSelect is called with the path of a row the user selected and whether it's a directory, the parent directory for the ".." row
+	onSelect func(p string, isDir bool)
+}
+
+func newDirList(w fyne.Window, cache *NodeCache, onSelect func(p string, isDir bool)) *dirList {
+	l := &dirList{w: w, cache: cache, cancel: func() {}, onSelect: onSelect}
+
+	l.table = widget.NewTableWithHeaders(
+		func() (int, int) { return l.rows(), len(listColumns) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, widget.NewIcon(nil), nil, label)
+		},
+		l.updateCell,
+	)
+	l.table.ShowHeaderColumn = false
+	l.table.CreateHeader = func() fyne.CanvasObject {
+		b := widget.NewButton("", nil)
+		b.Alignment = widget.ButtonAlignLeading
+		b.IconPlacement = widget.ButtonIconTrailingText
+		return b
+	}
+	l.table.UpdateHeader = l.updateHeader
+	l.table.OnSelected = func(id widget.TableCellID) {
+		if p, isDir, ok := l.pathOf(id.Row); ok {
+			l.onSelect(p, isDir)
+		}
+	}
+
+	for i, column := range listColumns {
+		l.table.SetColumnWidth(i, column.width)
+	}
+
+	return l
+}
+
+// parentRow is true if the first row is "..", going up to the parent of dir.
+func (l *dirList) parentRow() bool {
+	return l.dir != "" && l.dir != "/"
+}
+
+func (l *dirList) rows() int {
+	if l.parentRow() {
+		return len(l.items) + 1
+	}
+	return len(l.items)
+}
+
+// item shown in row, false for the ".." row.
+func (l *dirList) item(row int) (ResourceItem, bool) {
+	if l.parentRow() {
+		row--
+	}
+
+	if row < 0 || row >= len(l.items) {
+		return ResourceItem{}, false
+	}
+	return l.items[row], true
+}
+
+// pathOf the node shown in row, and whether it's a directory.
+func (l *dirList) pathOf(row int) (p string, isDir bool, ok bool) {
+	if l.parentRow() && row == 0 {
+		return path.Dir(l.dir), true, true
+	}
+
+	item, ok := l.item(row)
+	return item.Path, item.IsDir, ok
+}
+
+func (l *dirList) updateCell(id widget.TableCellID, o fyne.CanvasObject) {
+	cell := o.(*fyne.Container)
+	label, icon := cell.Objects[0].(*widget.Label), cell.Objects[1].(*widget.Icon)
+
+	column := listColumn(id.Col)
+
+	if l.parentRow() && id.Row == 0 {
+		icon.SetResource(theme.FolderOpenIcon())
+		icon.Show()
+
+		if column == listColumnName {
+			label.SetText("..")
+		} else {
+			label.SetText("")
+		}
+		return
+	}
+
+	item, ok := l.item(id.Row)
+	if !ok {
+		label.SetText("")
+		icon.Hide()
+		return
+	}
+
+	if column == listColumnName {
+		if item.IsDir {
+			icon.SetResource(theme.FolderIcon())
+		} else {
+			icon.SetResource(theme.FileIcon())
+		}
+		icon.Show()
+	} else {
+		icon.Hide()
+	}
+
+	label.SetText(listCell(item, column))
+}
+
+func (l *dirList) updateHeader(id widget.TableCellID, o fyne.CanvasObject) {
+	b := o.(*widget.Button)
+	column := listColumn(id.Col)
+
+	b.SetText(listColumns[column].title)
+
+	switch {
+	case l.sort.column != column:
+		b.SetIcon(nil)
+	case l.sort.asc:
+		b.SetIcon(theme.MoveUpIcon())
+	default:
+		b.SetIcon(theme.MoveDownIcon())
+	}
+
+	b.OnTapped = func() {
+		s := listSort{column: column, asc: true}
+		if l.sort.column == column {
+			s.asc = !l.sort.asc
+		}
+		l.sort, l.sorted = s, true
+
+		sortListItems(l.items, l.sort)
+		l.table.UnselectAll()
+		l.table.Refresh()
+	}
+}
+
+// load the listing of dir and show it once it's loaded, stopping to load the previous one.
+func (l *dirList) load(dir string) {
+	l.cancel()
+
+	if dir != l.dir {
+		l.dir, l.res, l.items = dir, nil, nil
+		l.table.UnselectAll()
+		l.table.Refresh()
+		l.table.ScrollToTop()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+
+	go func() {
+		defer cancel()
+
+		res, err := l.cache.Info(ctx, dir)
+
+		fyne.DoAndWait(func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				slog.Error("could not list directory", "path", dir, "error", err)
+				notify(l.w, notifyError, fmt.Sprintf("could not list (%v): %v", dir, err))
+				return
+			}
+
+			l.show(res)
+		})
+	}()
+}
+
+// show the listing res, keeping the sorting the user chose.
+func (l *dirList) show(res *Resource) {
+	// the cache answers with the same listing until it changes
+	if res == l.res {
+		return
+	}
+	l.res = res
+
+	if !l.sorted {
+		l.sort = defaultListSort(res)
+	}
+
+	l.items = slices.Clone(res.Items)
+	sortListItems(l.items, l.sort)
+
+	// the rows moved, keeping the selected cell would select another node
+	l.table.UnselectAll()
+	l.table.Refresh()
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSortListItems(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	items := []ResourceItem{
+		{Name: "b.txt", Size: 10, Extension: ".txt", Modified: now, Type: "text"},
+		{Name: "A.mp4", Size: 300, Extension: ".mp4", Modified: now.Add(-time.Hour), Type: "video"},
+		{Name: "docs", IsDir: true, Modified: now.Add(-2 * time.Hour)},
+		{Name: "c.txt", Size: 10, Extension: ".txt", Modified: now.Add(time.Hour), Type: "text"},
+		{Name: "Archive", IsDir: true, Modified: now},
+	}
+
+	tests := []struct {
+		sort listSort
+		want []string
+	}{
+		{listSort{column: listColumnName, asc: true}, []string{"Archive", "docs", "A.mp4", "b.txt", "c.txt"}},
+		{listSort{column: listColumnName}, []string{"docs", "Archive", "c.txt", "b.txt", "A.mp4"}},
+		// equal sizes are sorted by name
+		{listSort{column: listColumnSize, asc: true}, []string{"Archive", "docs", "b.txt", "c.txt", "A.mp4"}},
+		{listSort{column: listColumnModified}, []string{"Archive", "docs", "c.txt", "b.txt", "A.mp4"}},
+		{listSort{column: listColumnType, asc: true}, []string{"Archive", "docs", "b.txt", "c.txt", "A.mp4"}},
+		{listSort{column: listColumnExtension, asc: true}, []string{"Archive", "docs", "A.mp4", "b.txt", "c.txt"}},
+	}
+
+	for _, test := range tests {
+		sorted := slices.Clone(items)
+		sortListItems(sorted, test.sort)
+
+		names := make([]string, len(sorted))
+		for i := range sorted {
+			names[i] = sorted[i].Name
+		}
+
+		if !slices.Equal(names, test.want) {
+			t.Errorf("sorted by (%+v): expected (%v), got (%v)", test.sort, test.want, names)
+		}
+	}
+}
+
+func TestDefaultListSort(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]listSort{
+		"":         {column: listColumnName, asc: true},
+		"name":     {column: listColumnName},
+		"size":     {column: listColumnSize},
+		"modified": {column: listColumnModified},
+	}
+
+	for by, want := range tests {
+		res := &Resource{}
+		res.Sorting.By = by
+
+		if got := defaultListSort(res); got != want {
+			t.Errorf("defaultListSort(%q) = %+v, want %+v", by, got, want)
+		}
+	}
+}
+
+func TestListCell(t *testing.T) {
+	t.Parallel()
+
+	file := ResourceItem{Name: "a\nb", Size: 1536, Type: "text", Mode: 0o644}
+	dir := ResourceItem{Name: "d", IsDir: true, Size: 4096, Mode: 1<<31 | 0o755}
+
+	tests := []struct {
+		item   ResourceItem
+		column listColumn
+		want   string
+	}{
+		{file, listColumnName, `a\nb`},
+		{file, listColumnSize, "1.50 KiB"},
+		{file, listColumnType, "text"},
+		{file, listColumnMode, "-rw-r--r--"},
+		{dir, listColumnSize, ""},
+		{dir, listColumnType, "directory"},
+		{dir, listColumnMode, "drwxr-xr-x"},
+	}
+
+	for _, test := range tests {
+		if got := listCell(test.item, test.column); got != test.want {
+			t.Errorf("listCell(%v, %v) = %v, want %v", test.item.Name, test.column, got, test.want)
+		}
+	}
+}
+
+func TestDirListPathOf(t *testing.T) {
+	t.Parallel()
+
+	l := &dirList{dir: "/a/b", items: []ResourceItem{
+		{Path: "/a/b/c", IsDir: true},
+		{Path: "/a/b/f"},
+	}}
+
+	tests := []struct {
+		row   int
+		p     string
+		isDir bool
+		ok    bool
+	}{
+		{0, "/a", true, true},
+		{1, "/a/b/c", true, true},
+		{2, "/a/b/f", false, true},
+		{3, "", false, false},
+	}
+
+	for _, test := range tests {
+		p, isDir, ok := l.pathOf(test.row)
+		if p != test.p || isDir != test.isDir || ok != test.ok {
+			t.Errorf("pathOf(%v) = (%v, %v, %v), want (%v, %v, %v)", test.row, p, isDir, ok, test.p, test.isDir, test.ok)
+		}
+	}
+}
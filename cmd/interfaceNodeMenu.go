@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// nodeAction offered by the context menu of a remote node.
+type nodeAction struct {
+	label string
+
+	// perms the user needs for the action
+	perms []permission
+
+	// filesOnly actions are disabled for directories, notRoot ones for the root
+	filesOnly bool
+	notRoot   bool
+
+	// separated from the actions before it in the menu
+	separated bool
+
+	run func(m *nodeMenu, p string, isDir bool)
+}
+
+// nodeActions in the order they're offered.
+var nodeActions = []nodeAction{
+	{label: "Download", perms: []permission{permDownload}, run: (*nodeMenu).download},
+	{label: "Rename…", perms: []permission{permRename}, notRoot: true, separated: true, run: (*nodeMenu).rename},
+	{label: "Move to…", perms: []permission{permRename}, notRoot: true, run: (*nodeMenu).move},
+	{label: "Copy to…", perms: []permission{permCreate}, notRoot: true, run: (*nodeMenu).copyTo},
+	{label: "Delete", perms: []permission{permDelete}, notRoot: true, run: (*nodeMenu).remove},
+	{label: "Share", perms: []permission{permShare, permDownload}, separated: true, run: (*nodeMenu).share},
+	{label: "Checksum", filesOnly: true, run: (*nodeMenu).checksum},
+	{label: "Copy remote path", separated: true, run: (*nodeMenu).copyPath},
+	{label: "Copy raw URL", perms: []permission{permDownload}, run: (*nodeMenu).copyRawURL},
+	{label: "Properties", separated: true, run: (*nodeMenu).properties},
+}
+
+// enabled is true if a can be done to p by a user with the permissions of can.
+func (a nodeAction) enabled(p string, isDir bool, can func(permission) bool) bool {
+	if (a.filesOnly && isDir) || (a.notRoot && path.Clean("/"+p) == "/") {
+		return false
+	}
+
+	for _, perm := range a.perms {
+		if !can(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeMenu is the context menu of the remote nodes shown in w. Only used on the fyne goroutine.
+type nodeMenu struct {
+	w     fyne.Window
+	sess  *filebrowserSession
+	cache *NodeCache
+
+	// changed is called with the directories whose listing an action changed
+	changed func(dirs ...string)
+
+	// checksummed is called with the file whose checksum was calculated
+	checksummed func(p string)
+}
+
+// show the menu of the node p at the absolute position pos of the canvas.
+func (m *nodeMenu) show(p string, isDir bool, pos fyne.Position) {
+	p = path.Clean("/" + p)
+
+	menu := fyne.NewMenu("")
+	for _, action := range nodeActions {
+		if action.separated {
+			menu.Items = append(menu.Items, fyne.NewMenuItemSeparator())
+		}
+
+		item := fyne.NewMenuItem(action.label, func() { action.run(m, p, isDir) })
+		item.Disabled = !action.enabled(p, isDir, m.sess.can)
+		menu.Items = append(menu.Items, item)
+	}
+
+	widget.ShowPopUpMenuAtPosition(menu, m.w.Canvas(), pos)
+}
+
+// background runs f outside of the fyne goroutine, notifying about its error with what failed or calling done on the fyne goroutine.
+func (m *nodeMenu) background(what string, f func(ctx context.Context) error, done func()) {
+	go func() {
+		err := f(context.Background())
+
+		fyne.Do(func() {
+			if err != nil {
+				notify(m.w, notifyError, fmt.Sprintf("could not %v: %v", what, err))
+				return
+			}
+			done()
+		})
+	}()
+}
+
+// askPath of a node with title, starting with text, calling f with the confirmed text.
+func (m *nodeMenu) askPath(title, label, confirm, text string, f func(text string)) {
+	entry := widget.NewEntry()
+	entry.SetText(text)
+	entry.Validator = func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return errors.New("can't be empty")
+		}
+		return nil
+	}
+
+	dialog.ShowForm(title, confirm, "Cancel", []*widget.FormItem{widget.NewFormItem(label, entry)}, func(confirmed bool) {
+		if confirmed {
+			f(strings.TrimSpace(entry.Text))
+		}
+	}, m.w)
+
+	m.w.Canvas().Focus(entry)
+}
+
+func (m *nodeMenu) download(p string, isDir bool) {
+	d := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+		if err != nil {
+			notify(m.w, notifyError, fmt.Sprintf("could not choose where to download (%v): %v", p, err))
+			return
+		}
+		if wc == nil {
+			return
+		}
+
+		local := wc.URI().Path()
+
+		m.background(fmt.Sprintf("download (%v)", p), func(ctx context.Context) error {
+			err := m.sess.Download(ctx, p, isDir, wc)
+			return errors.Join(err, wc.Close())
+		}, func() {
+			notify(m.w, notifyInfo, fmt.Sprintf("Downloaded (%v) to (%v)", p, local))
+		})
+	}, m.w)
+
+	name := path.Base(p)
+	if isDir {
+		name += ".zip"
+	}
+	d.SetFileName(name)
+	d.Show()
+}
+
+func (m *nodeMenu) rename(p string, _ bool) {
+	m.askPath("Rename "+path.Base(p), "Name", "Rename", path.Base(p), func(name string) {
+		if name == path.Base(p) {
+			return
+		}
+
+		// "." and ".." would move p onto its parent directories
+		if strings.Contains(name, "/") || name == "." || name == ".." {
+			notify(m.w, notifyError, fmt.Sprintf("could not rename (%v), (%v) is not a name", p, name))
+			return
+		}
+
+		dst := path.Join(path.Dir(p), name)
+		m.background(fmt.Sprintf("rename (%v)", p), func(ctx context.Context) error {
+			return m.sess.Move(ctx, p, dst)
+		}, func() {
+			m.cache.Forget(p)
+			m.changed(path.Dir(p))
+		})
+	})
+}
+
+func (m *nodeMenu) move(p string, _ bool) {
+	m.askPath("Move "+path.Base(p), "Into directory", "Move", path.Dir(p), func(dir string) {
+		dir = path.Clean("/" + dir)
+
+		m.background(fmt.Sprintf("move (%v) into (%v)", p, dir), func(ctx context.Context) error {
+			return m.sess.Move(ctx, p, path.Join(dir, path.Base(p)))
+		}, func() {
+			m.cache.Forget(p)
+			m.changed(path.Dir(p), dir)
+		})
+	})
+}
+
+func (m *nodeMenu) copyTo(p string, _ bool) {
+	m.askPath("Copy "+path.Base(p), "Into directory", "Copy", path.Dir(p), func(dir string) {
+		dir = path.Clean("/" + dir)
+
+		m.background(fmt.Sprintf("copy (%v) into (%v)", p, dir), func(ctx context.Context) error {
+			return m.sess.Copy(ctx, p, path.Join(dir, path.Base(p)))
+		}, func() { m.changed(dir) })
+	})
+}
+
+func (m *nodeMenu) remove(p string, isDir bool) {
+	msg := fmt.Sprintf("Delete (%v)?", p)
+	if isDir {
+		msg = fmt.Sprintf("Delete (%v) and everything in it?", p)
+	}
+
+	dialog.ShowConfirm("Delete "+path.Base(p), msg, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		m.background(fmt.Sprintf("delete (%v)", p), func(ctx context.Context) error {
+			return m.sess.Delete(ctx, p)
+		}, func() {
+			m.cache.Forget(p)
+			m.changed(path.Dir(p))
+		})
+	}, m.w)
+}
+
+func (m *nodeMenu) share(p string, _ bool) {
+	var link string
+	m.background(fmt.Sprintf("share (%v)", p), func(ctx context.Context) (err error) {
+		link, err = m.sess.Share(ctx, p)
+		return err
+	}, func() {
+		m.w.Clipboard().SetContent(link)
+		ShowDismissablePopup(m.w, link)
+	})
+}
+
+func (m *nodeMenu) checksum(p string, _ bool) {
+	var sum string
+	m.background(fmt.Sprintf("checksum (%v)", p), func(ctx context.Context) (err error) {
+		sum, err = m.cache.SHA256(ctx, p)
+		return err
+	}, func() {
+		m.checksummed(p)
+		ShowDismissablePopup(m.w, sum)
+	})
+}
+
+func (m *nodeMenu) copyPath(p string, _ bool) {
+	m.w.Clipboard().SetContent(p)
+	notify(m.w, notifyInfo, fmt.Sprintf("Copied (%v)", p))
+}
+
+func (m *nodeMenu) copyRawURL(p string, isDir bool) {
+	raw, err := m.sess.rawURL(p, isDir)
+	if err != nil {
+		notify(m.w, notifyError, fmt.Sprintf("could not copy raw url of (%v): %v", p, err))
+		return
+	}
+
+	m.w.Clipboard().SetContent(raw)
+	notify(m.w, notifyInfo, fmt.Sprintf("Copied (%v)", raw))
+}
+
+func (m *nodeMenu) properties(p string, _ bool) {
+	var res *Resource
+	m.background(fmt.Sprintf("get properties of (%v)", p), func(ctx context.Context) (err error) {
+		res, err = m.cache.Info(ctx, p)
+		return err
+	}, func() {
+		pane := newPropertiesPane(m.sess, m.cache, func(err error) { notify(m.w, notifyError, err.Error()) })
+		pane.show(res)
+
+		d := dialog.NewCustom("Properties of "+path.Base(p), "Close", pane.content, m.w)
+		d.SetOnClosed(pane.stop)
+		d.Resize(fyne.NewSize(520, 400))
+		d.Show()
+	})
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import "testing"
+
+func TestNodeActionEnabled(t *testing.T) {
+	t.Parallel()
+
+	actions := make(map[string]nodeAction)
+	for _, action := range nodeActions {
+		actions[action.label] = action
+	}
+
+	all := func(permission) bool { return true }
+	noDownload := func(perm permission) bool { return perm != permDownload }
+
+	tests := []struct {
+		label string
+		p     string
+		isDir bool
+		can   func(permission) bool
+		want  bool
+	}{
+		{"Delete", "/a.txt", false, all, true},
+		{"Delete", "/", true, all, false},
+		{"Rename…", "/d", true, all, true},
+		{"Checksum", "/a.txt", false, all, true},
+		{"Checksum", "/d", true, all, false},
+		{"Download", "/a.txt", false, noDownload, false},
+		{"Share", "/a.txt", false, noDownload, false},
+		{"Copy to…", "/a.txt", false, noDownload, true},
+		{"Copy remote path", "/", true, noDownload, true},
+	}
+
+	for _, test := range tests {
+		action, ok := actions[test.label]
+		if !ok {
+			t.Fatalf("no action (%v)", test.label)
+		}
+
+		if got := action.enabled(test.p, test.isDir, test.can); got != test.want {
+			t.Errorf("(%v).enabled(%v, %v) = %v, want %v", test.label, test.p, test.isDir, got, test.want)
+		}
+	}
+}
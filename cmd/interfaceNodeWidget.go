@@ -17,9 +17,15 @@ type nodeWidget struct {
 	checksumButtonFuncLock sync.RWMutex
 
 	filenameLabel *widget.Label
+
+	// onSecondaryTapped shows the context menu of the node, only used on the fyne goroutine
+	onSecondaryTapped func(ev *fyne.PointEvent)
 }
 
-var _ fyne.Widget = &nodeWidget{}
+var (
+	_ fyne.Widget            = &nodeWidget{}
+	_ fyne.SecondaryTappable = &nodeWidget{}
+)
 
 func NewNodeWidget() *nodeWidget {
 	nw := &nodeWidget{}
@@ -48,6 +54,27 @@ func (nw *nodeWidget) SetButtonFunc(f func()) {
 	nw.checksumButtonFunc = f
 }
 
+// SetButton text, and if the button is shown at all.
+func (nw *nodeWidget) SetButton(text string, visible bool) {
+	nw.checksumButton.SetText(text)
+	if visible {
+		nw.checksumButton.Show()
+	} else {
+		nw.checksumButton.Hide()
+	}
+}
+
+// SetMenuFunc called with a right click or secondary tap on the node, nil for none.
+func (nw *nodeWidget) SetMenuFunc(f func(ev *fyne.PointEvent)) {
+	nw.onSecondaryTapped = f
+}
+
+func (nw *nodeWidget) TappedSecondary(ev *fyne.PointEvent) {
+	if nw.onSecondaryTapped != nil {
+		nw.onSecondaryTapped(ev)
+	}
+}
+
 func (nw *nodeWidget) CreateRenderer() fyne.WidgetRenderer {
 	return widget.NewSimpleRenderer(container.NewHBox(nw.filenameLabel, nw.checksumButton))
 }
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// toastDuration a toast is shown for before it hides itself
+	toastDuration = 6 * time.Second
+
+	// maxToasts shown in a window at once, the oldest is hidden for a new one
+	maxToasts = 3
+
+	// maxToastLength in runes, the full message is in the notifications panel
+	maxToastLength = 80
+
+	// notificationsPanelHeight of the expanded notifications panel
+	notificationsPanelHeight = 180
+)
+
+// notifications of the application, shown as toasts and in the notifications panel.
+var notifications = newNotificationCenter()
+
+// toastLayers of the windows that show toasts, only used on the fyne goroutine.
+var toastLayers = make(map[fyne.Window]*fyne.Container)
+
+// withToasts wraps the content of w so notifications for w are shown over it as toasts.
+// forgetToasts must be called when w is closed.
+func withToasts(w fyne.Window, content fyne.CanvasObject) fyne.CanvasObject {
+	toasts := container.NewVBox()
+	toastLayers[w] = toasts
+
+	return container.NewStack(content, container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), toasts), nil, nil))
+}
+
+// forgetToasts of the closed window w.
+func forgetToasts(w fyne.Window) {
+	delete(toastLayers, w)
+}
+
+// notify the user of message without blocking them, as a toast over w and in the notifications panel.
+// Windows that don't show toasts, like the login screen, show a dismissable popup instead. Must be called on the fyne goroutine.
+func notify(w fyne.Window, level notificationLevel, message string) {
+	n := notifications.add(level, message)
+
+	toasts, ok := toastLayers[w]
+	if !ok {
+		ShowDismissablePopup(w, message)
+		return
+	}
+
+	text := []rune(strings.ReplaceAll(n.Message, "\n", " "))
+	if len(text) > maxToastLength {
+		text = append(text[:maxToastLength], '…')
+	}
+
+	icon := theme.InfoIcon()
+	if n.Level == notifyError {
+		icon = theme.ErrorIcon()
+	}
+
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameOverlayBackground))
+	background.StrokeColor = theme.Color(theme.ColorNameInputBorder)
+	background.StrokeWidth = 1
+	background.CornerRadius = theme.InputRadiusSize()
+
+	var toast fyne.CanvasObject
+	hide := func() { toasts.Remove(toast) }
+
+	toast = container.NewStack(background, container.NewHBox(
+		widget.NewIcon(icon),
+		widget.NewLabel(string(text)),
+		widget.NewButtonWithIcon("", theme.CancelIcon(), hide),
+	))
+
+	toasts.Add(toast)
+	for len(toasts.Objects) > maxToasts {
+		toasts.Remove(toasts.Objects[0])
+	}
+
+	time.AfterFunc(toastDuration, func() { fyne.Do(hide) })
+}
+
+// handleError that blocks progress as a modal over w and in the notifications panel,
+// calling okay once the user dismissed it. It may be called from any goroutine.
+func handleError(w fyne.Window, err error, okay func()) {
+	notifications.add(notifyError, err.Error())
+
+	fyne.Do(func() { showDismissablePopup(w, err.Error(), okay) })
+}
+
+// newNotificationsPanel of w, a header with the number of unseen errors that expands into a list of every notification.
+func newNotificationsPanel(w fyne.Window) fyne.CanvasObject {
+	var entries []notification
+
+	details := widget.NewMultiLineEntry()
+	details.Wrapping = fyne.TextWrapWord
+	details.SetPlaceHolder("Select a notification to see all of it")
+	shown := ""
+	details.OnChanged = func(_ string) {
+		details.SetText(shown)
+	}
+	show := func(text string) {
+		shown = text
+		details.SetText(text)
+	}
+
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject {
+			return container.NewHBox(widget.NewIcon(theme.InfoIcon()), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			if id >= len(entries) {
+				return
+			}
+			n := entries[id]
+
+			icon := theme.InfoIcon()
+			if n.Level == notifyError {
+				icon = theme.ErrorIcon()
+			}
+
+			row := o.(*fyne.Container)
+			row.Objects[0].(*widget.Icon).SetResource(icon)
+			row.Objects[1].(*widget.Label).SetText(n.Time.Local().Format(time.TimeOnly) + "  " + strings.ReplaceAll(n.Message, "\n", " "))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		if id < len(entries) {
+			show(entries[id].String())
+		}
+	}
+
+	header := widget.NewButtonWithIcon("", theme.MenuExpandIcon(), nil)
+	header.Alignment = widget.ButtonAlignLeading
+
+	buttons := container.NewHBox(
+		widget.NewButton("Copy", func() {
+			if shown != "" {
+				w.Clipboard().SetContent(shown)
+			}
+		}),
+		widget.NewButton("Copy all", func() {
+			lines := make([]string, 0, len(entries))
+			for i := range entries {
+				lines = append(lines, entries[i].String())
+			}
+			w.Clipboard().SetContent(strings.Join(lines, "\n"))
+		}),
+	)
+
+	minHeight := canvas.NewRectangle(color.Transparent)
+	minHeight.SetMinSize(fyne.NewSize(0, notificationsPanelHeight))
+
+	body := container.NewStack(minHeight, container.NewBorder(nil, buttons, nil, nil,
+		container.NewGridWithColumns(2, list, details),
+	))
+	body.Hide()
+
+	reload := func() {
+		if body.Visible() {
+			notifications.markSeen()
+		}
+
+		// indices shift as notifications come in, the details stay until another is selected
+		entries = notifications.list()
+		list.UnselectAll()
+		list.Refresh()
+
+		header.SetText("Notifications")
+		header.Importance = widget.MediumImportance
+		if unseen := notifications.unseen(); unseen > 0 {
+			header.SetText(fmt.Sprintf("Notifications (%v new errors)", unseen))
+			header.Importance = widget.DangerImportance
+		}
+
+		header.SetIcon(theme.MenuExpandIcon())
+		if body.Visible() {
+			header.SetIcon(theme.MenuDropDownIcon())
+		}
+		header.Refresh()
+	}
+
+	header.OnTapped = func() {
+		if body.Visible() {
+			body.Hide()
+		} else {
+			body.Show()
+		}
+		reload()
+	}
+
+	buttons.Add(widget.NewButton("Clear", func() {
+		notifications.clear()
+		show("")
+		reload()
+	}))
+
+	// the panel lives as long as the main window, so it never unsubscribes
+	notifications.subscribe(func(_ notification) { fyne.Do(reload) })
+	reload()
+
+	return container.NewVBox(header, body)
+}
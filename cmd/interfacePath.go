@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// maxPathCompletions shown below the path entry at once
+const maxPathCompletions = 8
+
+// breadcrumb is a segment of a remote path, the path up to and including it.
+type breadcrumb struct {
+	name string
+	path string
+}
+
+// breadcrumbs of the remote path p, starting with the root.
+func breadcrumbs(p string) []breadcrumb {
+	crumbs := []breadcrumb{{name: "/", path: "/"}}
+
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return crumbs
+	}
+
+	for i := 1; i <= len(p); i++ {
+		if i == len(p) || p[i] == '/' {
+			crumbs = append(crumbs, breadcrumb{name: path.Base(p[:i]), path: p[:i]})
+		}
+	}
+
+	return crumbs
+}
+
+// pathCompletionDir is the directory listing the completions of the typed input, and the start of the name being typed.
+func pathCompletionDir(input string) (dir, prefix string) {
+	input = "/" + strings.TrimLeft(input, "/")
+
+	i := strings.LastIndex(input, "/")
+	return path.Clean(input[:i+1]), input[i+1:]
+}
+
+// pathCompletions of input from the listing res of its pathCompletionDir, directories ending with a /.
+// Names are matched without case.
+func pathCompletions(input string, res *Resource) []string {
+	dir, prefix := pathCompletionDir(input)
+	prefix = strings.ToLower(prefix)
+
+	var completions []string
+	for i := range res.Items {
+		item := &res.Items[i]
+		if !strings.HasPrefix(strings.ToLower(item.Name), prefix) {
+			continue
+		}
+
+		completion := path.Join(dir, item.Name)
+		if item.IsDir {
+			completion += "/"
+		}
+		completions = append(completions, completion)
+	}
+
+	return completions
+}
+
+// completionEntry is a widget.Entry with completions of its text shown in completions, which goes below it.
+// Tab completes the first of them and Escape hides them, or calls onCancel if they're hidden.
+// Completions aren't shown in a pop up, it would take the keyboard focus of the entry.
+type completionEntry struct {
+	widget.Entry
+
+	options     []string
+	completions *fyne.Container
+
+	onCancel func()
+}
+
+func newCompletionEntry() *completionEntry {
+	e := &completionEntry{completions: container.NewVBox()}
+	e.completions.Hide()
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+// showCompletions of the text, hiding them if there are none.
+func (e *completionEntry) showCompletions(options []string) {
+	e.options = options
+	if len(options) > maxPathCompletions {
+		e.options = options[:maxPathCompletions]
+	}
+
+	e.completions.RemoveAll()
+
+	if len(e.options) == 0 {
+		e.completions.Hide()
+		return
+	}
+
+	for _, option := range e.options {
+		button := widget.NewButton(strings.ReplaceAll(option, "\n", "\\n"), func() {
+			e.complete(option)
+			fyne.CurrentApp().Driver().CanvasForObject(e).Focus(e)
+		})
+		button.Alignment = widget.ButtonAlignLeading
+		button.Importance = widget.LowImportance
+		e.completions.Add(button)
+	}
+	e.completions.Show()
+}
+
+func (e *completionEntry) hideCompletions() {
+	e.options = nil
+	e.completions.RemoveAll()
+	e.completions.Hide()
+}
+
+// complete the text to option.
+func (e *completionEntry) complete(option string) {
+	e.SetText(option)
+	e.CursorColumn = len([]rune(option))
+	e.Refresh()
+}
+
+func (e *completionEntry) AcceptsTab() bool {
+	return len(e.options) > 0
+}
+
+func (e *completionEntry) TypedKey(ev *fyne.KeyEvent) {
+	switch ev.Name {
+	case fyne.KeyTab:
+		if len(e.options) > 0 {
+			e.complete(e.options[0])
+		}
+	case fyne.KeyEscape:
+		if e.completions.Visible() {
+			e.hideCompletions()
+			return
+		}
+		if e.onCancel != nil {
+			e.onCancel()
+		}
+	default:
+		e.Entry.TypedKey(ev)
+	}
+}
+
+// pathBar shows the breadcrumbs of the selected node, or an entry to type a remote path to open instead.
+// Only used on the fyne goroutine.
+type pathBar struct {
+	w     fyne.Window
+	cache *NodeCache
+
+	crumbs *fyne.Container
+	entry  *completionEntry
+	bar    *fyne.Container
+
+	// p shown by the breadcrumbs, the selected node
+	p string
+
+	// open the remote path p in the tree
+	open func(p string)
+
+	// cancelCompletion stops loading the listing to complete the previous text
+	cancelCompletion context.CancelFunc
+}
+
+func newPathBar(w fyne.Window, cache *NodeCache, open func(p string)) *pathBar {
+	b := &pathBar{w: w, cache: cache, open: open, cancelCompletion: func() {}}
+
+	b.crumbs = container.NewHBox()
+
+	b.entry = newCompletionEntry()
+	b.entry.SetPlaceHolder("Path to open, ex: /photos/2024")
+	b.entry.OnChanged = b.complete
+	b.entry.OnSubmitted = func(text string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		b.stopEditing()
+		b.open(path.Clean("/" + text))
+	}
+	b.entry.onCancel = b.stopEditing
+	b.entry.Hide()
+
+	editButton := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+		if b.entry.Visible() {
+			b.stopEditing()
+			return
+		}
+		b.edit()
+	})
+
+	row := container.NewBorder(nil, nil, nil, editButton, container.NewStack(container.NewHScroll(b.crumbs), b.entry))
+	b.bar = container.NewVBox(row, b.entry.completions)
+
+	b.setPath("/")
+
+	return b
+}
+
+// setPath shown by the breadcrumbs.
+func (b *pathBar) setPath(p string) {
+	b.p = p
+	b.crumbs.RemoveAll()
+
+	for i, crumb := range breadcrumbs(p) {
+		if i > 1 {
+			b.crumbs.Add(widget.NewLabel("›"))
+		}
+
+		button := widget.NewButton(strings.ReplaceAll(crumb.name, "\n", "\\n"), func() { b.open(crumb.path) })
+		button.Importance = widget.LowImportance
+		b.crumbs.Add(button)
+	}
+}
+
+// edit the path in the entry instead of showing the breadcrumbs.
+func (b *pathBar) edit() {
+	text := b.p
+	if text != "/" {
+		text += "/"
+	}
+
+	b.entry.Show()
+	b.entry.SetText(text)
+	b.entry.CursorColumn = len([]rune(text))
+	b.w.Canvas().Focus(b.entry)
+}
+
+func (b *pathBar) stopEditing() {
+	b.cancelCompletion()
+	b.entry.hideCompletions()
+	b.entry.Hide()
+}
+
+// complete text with the cached listing of the directory being typed, loading it if needed.
+func (b *pathBar) complete(text string) {
+	b.cancelCompletion()
+
+	if !b.entry.Visible() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancelCompletion = cancel
+
+	dir, _ := pathCompletionDir(text)
+
+	go func() {
+		defer cancel()
+
+		res, err := b.cache.Info(ctx, dir)
+
+		fyne.DoAndWait(func() {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				slog.Debug("could not list directory to complete path", "path", dir, "error", err)
+				b.entry.hideCompletions()
+				return
+			}
+
+			b.entry.showCompletions(pathCompletions(text, res))
+		})
+	}()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBreadcrumbs(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][]breadcrumb{
+		"":       {{"/", "/"}},
+		"/":      {{"/", "/"}},
+		"/a":     {{"/", "/"}, {"a", "/a"}},
+		"/a/b c": {{"/", "/"}, {"a", "/a"}, {"b c", "/a/b c"}},
+		"a//b/":  {{"/", "/"}, {"a", "/a"}, {"b", "/a/b"}},
+	}
+
+	for p, want := range tests {
+		if got := breadcrumbs(p); !slices.Equal(got, want) {
+			t.Errorf("breadcrumbs(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestPathCompletions(t *testing.T) {
+	t.Parallel()
+
+	res := testListing("/photos", "/photos/2023/", "/photos/2024/", "/photos/readme.txt", "/photos/Raw/")
+	for i := range res.Items {
+		res.Items[i].Name = res.Items[i].Path[len("/photos/"):]
+	}
+
+	tests := map[string][]string{
+		"/photos/":   {"/photos/2023/", "/photos/2024/", "/photos/readme.txt", "/photos/Raw/"},
+		"/photos/20": {"/photos/2023/", "/photos/2024/"},
+		"photos/r":   {"/photos/readme.txt", "/photos/Raw/"},
+		"/photos/x":  nil,
+	}
+
+	for input, want := range tests {
+		if dir, _ := pathCompletionDir(input); dir != "/photos" {
+			t.Errorf("pathCompletionDir(%q) = %v, want /photos", input, dir)
+		}
+
+		if got := pathCompletions(input, res); !slices.Equal(got, want) {
+			t.Errorf("pathCompletions(%q) = %v, want %v", input, got, want)
+		}
+	}
+
+	if dir, prefix := pathCompletionDir("ph"); dir != "/" || prefix != "ph" {
+		t.Errorf("pathCompletionDir(ph) = %v, %v, want /, ph", dir, prefix)
+	}
+}
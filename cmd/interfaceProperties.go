@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// dirUsageProgressInterval between reports of the usage of a directory while it's walked
+const dirUsageProgressInterval = 250 * time.Millisecond
+
+// property of a resource shown in a propertiesPane.
+type property struct {
+	name  string
+	value string
+}
+
+// resourceProperties of res shown for every resource, timestamps relative to now.
+func resourceProperties(res *Resource, now time.Time) []property {
+	escape := func(s string) string { return strings.ReplaceAll(s, "\n", "\\n") }
+
+	props := []property{
+		{"Name", escape(res.Name)},
+		{"Path", escape(res.Path)},
+	}
+
+	kind := "File"
+	switch {
+	case res.IsDir:
+		kind = "Directory"
+	case res.Type != "":
+		kind = "File (" + res.Type + ")"
+	}
+	if res.IsSymlink {
+		kind += ", symbolic link"
+	}
+	props = append(props, property{"Type", kind})
+
+	if !res.IsDir {
+		if res.Extension != "" {
+			props = append(props, property{"Extension", escape(res.Extension)})
+		}
+		props = append(props, property{"Size", formatSize(int64(res.Size))})
+	} else {
+		props = append(props, property{"Contains", formatCount(res.NumDirs, "directory", "directories") + ", " + formatCount(res.NumFiles, "file", "files")})
+	}
+
+	return append(props,
+		property{"Modified", formatTimestamp(res.Modified, now)},
+		property{"Mode", formatMode(fs.FileMode(res.Mode))},
+	)
+}
+
+// dirUsage is what a directory holds, recursively.
+type dirUsage struct {
+	size  int64
+	files int
+	dirs  int
+}
+
+func (u dirUsage) String() string {
+	return fmt.Sprintf("%v in %v, %v", formatSize(u.size), formatCount(u.files, "file", "files"), formatCount(u.dirs, "directory", "directories"))
+}
+
+// walkDirUsage of dir from the listings of sess, calling progress with the usage so far while walking.
+// Symbolic links to directories are counted but not followed.
+// The listings don't go through a NodeCache, a whole subtree would push out the ones the user browsed.
+func walkDirUsage(ctx context.Context, sess *filebrowserSession, dir string, progress func(dirUsage)) (dirUsage, error) {
+	var usage dirUsage
+
+	queue := []string{dir}
+	reported := time.Now()
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		res, err := sess.Info(ctx, p)
+		if err != nil {
+			return usage, fmt.Errorf("could not list (%v): %w", p, err)
+		}
+
+		for i := range res.Items {
+			item := &res.Items[i]
+			if !item.IsDir {
+				usage.files++
+				usage.size += int64(item.Size)
+				continue
+			}
+
+			usage.dirs++
+			if !item.IsSymlink {
+				queue = append(queue, item.Path)
+			}
+		}
+
+		if progress != nil && time.Since(reported) >= dirUsageProgressInterval {
+			progress(usage)
+			reported = time.Now()
+		}
+	}
+
+	return usage, nil
+}
+
+// propertiesPane shows the properties of a resource, the recursive usage of directories and the cached checksums of files.
+// Only used on the fyne goroutine.
+type propertiesPane struct {
+	sess  *filebrowserSession
+	cache *NodeCache
+
+	form    *fyne.Container
+	content fyne.CanvasObject
+
+	// res shown
+	res *Resource
+
+	// usage of res once it was walked, or the progress of walking it. walking is true until the walk finished or failed
+	usage     string
+	usageDone bool
+	walking   bool
+
+	// cancel walking res
+	cancel context.CancelFunc
+
+	// onError of walking or checksumming res
+	onError func(err error)
+}
+
+func newPropertiesPane(sess *filebrowserSession, cache *NodeCache, onError func(err error)) *propertiesPane {
+	pp := &propertiesPane{sess: sess, cache: cache, cancel: func() {}, onError: onError}
+
+	pp.form = container.New(layout.NewFormLayout())
+	pp.content = container.NewVScroll(pp.form)
+
+	return pp
+}
+
+// setText shown instead of properties, like while they're loading.
+func (pp *propertiesPane) setText(text string) {
+	pp.stop()
+	pp.res = nil
+
+	label := widget.NewLabel(text)
+	label.Wrapping = fyne.TextWrapWord
+
+	pp.form.Objects = []fyne.CanvasObject{layout.NewSpacer(), label}
+	pp.form.Refresh()
+}
+
+// show the properties of res.
+func (pp *propertiesPane) show(res *Resource) {
+	if pp.res == nil || nodeKey(pp.res.Path) != nodeKey(res.Path) {
+		pp.stop()
+		pp.usage, pp.usageDone, pp.walking = "", false, false
+	}
+	pp.res = res
+
+	pp.render()
+}
+
+// stop walking the resource shown.
+func (pp *propertiesPane) stop() {
+	pp.cancel()
+	pp.cancel = func() {}
+}
+
+// checksummed p, showing its checksum if it's shown.
+func (pp *propertiesPane) checksummed(p string) {
+	if pp.res != nil && nodeKey(pp.res.Path) == nodeKey(p) {
+		pp.render()
+	}
+}
+
+func (pp *propertiesPane) render() {
+	res := pp.res
+
+	var objs []fyne.CanvasObject
+	add := func(name string, value fyne.CanvasObject) {
+		key := widget.NewLabelWithStyle(name, fyne.TextAlignTrailing, fyne.TextStyle{Bold: true})
+		objs = append(objs, key, value)
+	}
+	text := func(s string) *widget.Label {
+		label := widget.NewLabel(s)
+		label.Selectable = true
+		label.Truncation = fyne.TextTruncateEllipsis
+		return label
+	}
+
+	for _, prop := range resourceProperties(res, time.Now()) {
+		add(prop.name, text(prop.value))
+	}
+
+	if res.IsDir {
+		switch {
+		case pp.usageDone:
+			add("Total size", text(pp.usage))
+		case pp.usage != "":
+			add("Total size", text(pp.usage+" so far…"))
+		case pp.walking:
+			add("Total size", text("Calculating…"))
+		default:
+			add("Total size", widget.NewButton("Calculate", pp.walk))
+		}
+	} else if sum, ok := pp.cache.CachedSHA256(res); ok {
+		add("SHA-256", text(sum))
+	} else {
+		add("SHA-256", widget.NewButton("Calculate", pp.checksum))
+	}
+
+	pp.form.Objects = objs
+	pp.form.Refresh()
+}
+
+// walk the directory shown to show its usage.
+func (pp *propertiesPane) walk() {
+	pp.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pp.cancel = cancel
+
+	res := pp.res
+	pp.usage, pp.walking = "", true
+	pp.render()
+
+	update := func(usage string, walking, done bool) {
+		fyne.Do(func() {
+			if ctx.Err() != nil || pp.res == nil || nodeKey(pp.res.Path) != nodeKey(res.Path) {
+				return
+			}
+			pp.usage, pp.walking, pp.usageDone = usage, walking, done
+			pp.render()
+		})
+	}
+
+	go func() {
+		usage, err := walkDirUsage(ctx, pp.sess, res.Path, func(usage dirUsage) { update(usage.String(), true, false) })
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("could not calculate size of directory", "path", res.Path, "error", err)
+				update("", false, false)
+				fyne.Do(func() { pp.onError(fmt.Errorf("could not calculate size of (%v): %w", res.Path, err)) })
+			}
+			return
+		}
+
+		update(usage.String(), false, true)
+	}()
+}
+
+// checksum the file shown.
+func (pp *propertiesPane) checksum() {
+	p := pp.res.Path
+
+	go func() {
+		if _, err := pp.cache.SHA256(context.Background(), p); err != nil {
+			fyne.Do(func() { pp.onError(fmt.Errorf("could not checksum (%v): %w", p, err)) })
+			return
+		}
+
+		fyne.Do(func() { pp.checksummed(p) })
+	}()
+}
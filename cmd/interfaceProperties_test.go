@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceProperties(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	file := &Resource{Path: "/a/b.txt", Name: "b.txt", Extension: ".txt", Type: "text", Size: 1536, Mode: 0o644, Modified: now.Add(-2 * time.Hour), IsSymlink: true}
+	want := []property{
+		{"Name", "b.txt"},
+		{"Path", "/a/b.txt"},
+		{"Type", "File (text), symbolic link"},
+		{"Extension", ".txt"},
+		{"Size", "1.50 KiB (1.54 kB, 1,536 bytes)"},
+		{"Modified", now.Add(-2*time.Hour).Local().Format(time.DateTime) + " (2 hours ago)"},
+		{"Mode", "-rw-r--r-- (0644)"},
+	}
+
+	if got := resourceProperties(file, now); !slices.Equal(got, want) {
+		t.Fatalf("expected properties (%v), got (%v)", want, got)
+	}
+
+	dir := &Resource{Path: "/a", Name: "a", IsDir: true, NumDirs: 1, NumFiles: 3, Mode: 1<<31 | 0o755, Modified: now}
+	want = []property{
+		{"Name", "a"},
+		{"Path", "/a"},
+		{"Type", "Directory"},
+		{"Contains", "1 directory, 3 files"},
+		{"Modified", now.Local().Format(time.DateTime) + " (just now)"},
+		{"Mode", "drwxr-xr-x (0755)"},
+	}
+
+	if got := resourceProperties(dir, now); !slices.Equal(got, want) {
+		t.Fatalf("expected properties (%v), got (%v)", want, got)
+	}
+
+	dir.NumDirs, dir.NumFiles = 0, 1
+	if got := resourceProperties(dir, now)[3]; got != (property{"Contains", "0 directories, 1 file"}) {
+		t.Fatalf("unexpected contents (%v)", got)
+	}
+
+	dir.NumDirs = 2
+	if got := resourceProperties(dir, now)[3]; got != (property{"Contains", "2 directories, 1 file"}) {
+		t.Fatalf("unexpected contents (%v)", got)
+	}
+}
+
+func TestWalkDirUsage(t *testing.T) {
+	t.Parallel()
+
+	listings := map[string]string{
+		"/":        `{"path":"/","isDir":true,"items":[{"path":"/a","isDir":true},{"path":"/f","size":100},{"path":"/link","isDir":true,"isSymlink":true}]}`,
+		"/a":       `{"path":"/a","isDir":true,"items":[{"path":"/a/g","size":20},{"path":"/a/b","isDir":true}]}`,
+		"/a/b":     `{"path":"/a/b","isDir":true,"items":[{"path":"/a/b/h","size":3}]}`,
+		"/link":    `{"path":"/link","isDir":true,"items":[{"path":"/link/loop","size":1000}]}`,
+		"/missing": "",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := "/" + strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/resources"), "/")
+		if listings[p] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprint(w, listings[p])
+	}))
+	defer srv.Close()
+
+	sess := &filebrowserSession{host: srv.URL}
+
+	usage, err := walkDirUsage(context.Background(), sess, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the symbolic link is counted, but not followed
+	if want := (dirUsage{size: 123, files: 3, dirs: 3}); usage != want {
+		t.Fatalf("expected usage (%+v), got (%+v)", want, usage)
+	}
+
+	if want := "123 bytes in 3 files, 3 directories"; usage.String() != want {
+		t.Fatalf("expected usage (%v), got (%v)", want, usage)
+	}
+
+	if _, err = walkDirUsage(context.Background(), sess, "/missing", nil); err == nil {
+		t.Fatal("expected walking a missing directory to fail")
+	}
+}
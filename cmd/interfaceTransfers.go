@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ctII/filebrowserui/wal"
+)
+
+// transfersRefreshInterval of the progress shown by the transfers panel.
+const transfersRefreshInterval = time.Second
+
+// transferRowWidget shows a transferRow with buttons to pause, retry, or cancel it.
+type transferRowWidget struct {
+	widget.BaseWidget
+
+	name     *widget.Label
+	status   *widget.Label
+	progress *widget.ProgressBar
+
+	pause  *widget.Button
+	retry  *widget.Button
+	cancel *widget.Button
+
+	// onPause, onRetry, and onCancel of the row currently shown, only used on the fyne goroutine
+	onPause, onRetry, onCancel func()
+}
+
+var _ fyne.Widget = &transferRowWidget{}
+
+func newTransferRowWidget() *transferRowWidget {
+	tw := &transferRowWidget{
+		name:     widget.NewLabel(""),
+		status:   widget.NewLabel(""),
+		progress: widget.NewProgressBar(),
+	}
+	tw.ExtendBaseWidget(tw)
+
+	call := func(f *func()) func() {
+		return func() {
+			if *f != nil {
+				(*f)()
+			}
+		}
+	}
+
+	tw.pause = widget.NewButton("Pause", call(&tw.onPause))
+	tw.retry = widget.NewButton("Retry", call(&tw.onRetry))
+	tw.cancel = widget.NewButton("Cancel", call(&tw.onCancel))
+
+	tw.name.Truncation = fyne.TextTruncateEllipsis
+
+	return tw
+}
+
+// set the row shown by the widget.
+func (tw *transferRowWidget) set(row *transferRow, onPause, onRetry, onCancel func()) {
+	tw.onPause, tw.onRetry, tw.onCancel = onPause, onRetry, onCancel
+
+	tw.name.SetText(strings.ReplaceAll(row.localPath, "\n", "\\n"))
+	tw.progress.SetValue(row.progress())
+
+	status := row.state.String()
+	switch row.state {
+	case transferActive:
+		status = fmt.Sprintf("%v of %v, %v/s", formatBytes(row.sent), formatBytes(row.size), formatBytes(int64(row.rate)))
+		if eta := row.eta(); eta > 0 {
+			status += fmt.Sprintf(", %v left", eta.Round(time.Second))
+		}
+	case transferFailed:
+		status = "failed: " + row.lastError
+	case transferCompleted:
+		status = fmt.Sprintf("completed, %v", formatBytes(row.size))
+	}
+	tw.status.SetText(status)
+
+	tw.pause.Hide()
+	tw.retry.Hide()
+	tw.cancel.Hide()
+
+	switch row.state {
+	case transferActive, transferQueued:
+		tw.pause.Show()
+		tw.cancel.Show()
+	case transferPaused, transferFailed:
+		tw.retry.Show()
+		tw.cancel.Show()
+	}
+}
+
+func (tw *transferRowWidget) CreateRenderer() fyne.WidgetRenderer {
+	buttons := container.NewHBox(tw.pause, tw.retry, tw.cancel)
+	info := container.NewGridWithColumns(2, tw.progress, tw.status)
+
+	return widget.NewSimpleRenderer(container.NewBorder(nil, nil, nil, buttons, container.NewGridWithColumns(2, tw.name, info)))
+}
+
+// transfer tree ids are the batch id prefixed with "b" for batches,
+// and the batch id and local path prefixed with "i" and separated by a NUL for files.
+func transferBatchNodeID(bid string) string { return "b" + bid }
+
+func transferItemNodeID(bid string, localPath string) string { return "i" + bid + "\x00" + localPath }
+
+// parseTransferNodeID into the batch id and, for files, the local path.
+func parseTransferNodeID(id string) (bid string, localPath string, isItem bool) {
+	if rest, ok := strings.CutPrefix(id, "i"); ok {
+		bid, localPath, _ = strings.Cut(rest, "\x00")
+		return bid, localPath, true
+	}
+	return strings.TrimPrefix(id, "b"), "", false
+}
+
+// showTransfers of uploads in a new window, live while it is open.
+func showTransfers(a fyne.App, uploads *uploadManager) {
+	w := a.NewWindow("Transfers")
+	w.Resize(fyne.NewSize(900, 500))
+
+	model := newTransfersModel()
+
+	// do an action of the upload manager for a row without blocking the UI
+	do := func(name string, action func(bid, localPath string) error, bid, localPath string) func() {
+		return func() {
+			go func() {
+				if err := action(bid, localPath); err != nil {
+					slog.Error("transfer action failed", "action", name, "path", localPath, "error", err)
+					fyne.Do(func() { notify(w, notifyError, fmt.Sprintf("could not %v (%v): %v", name, localPath, err)) })
+				}
+			}()
+		}
+	}
+
+	tree := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID {
+			if id == "" {
+				ids := make([]string, 0, len(model.order))
+				for _, bid := range model.order {
+					ids = append(ids, transferBatchNodeID(bid))
+				}
+				return ids
+			}
+
+			bid, _, _ := parseTransferNodeID(id)
+			b, ok := model.batches[bid]
+			if !ok {
+				return nil
+			}
+
+			ids := make([]string, 0, len(b.order))
+			for _, p := range b.order {
+				ids = append(ids, transferItemNodeID(bid, p))
+			}
+			return ids
+		},
+		func(id widget.TreeNodeID) bool {
+			_, _, isItem := parseTransferNodeID(id)
+			return id == "" || !isItem
+		},
+		func(branch bool) fyne.CanvasObject {
+			if branch {
+				return widget.NewLabel("")
+			}
+			return newTransferRowWidget()
+		},
+		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			bid, localPath, _ := parseTransferNodeID(id)
+
+			b, ok := model.batches[bid]
+			if !ok {
+				return
+			}
+
+			if branch {
+				o.(*widget.Label).SetText(b.summary())
+				return
+			}
+
+			row, ok := b.rows[localPath]
+			if !ok {
+				return
+			}
+
+			o.(*transferRowWidget).set(row,
+				do("pause", uploads.Pause, bid, localPath),
+				do("retry", uploads.Retry, bid, localPath),
+				do("cancel", uploads.Cancel, bid, localPath),
+			)
+		},
+	)
+
+	events, dropped, unsubscribe := uploads.wal.SubscribeCountingDrops(1024)
+	stop := make(chan struct{})
+
+	w.SetOnClosed(func() {
+		forgetToasts(w)
+		close(stop)
+		unsubscribe()
+	})
+
+	status := widget.NewLabel("Loading transfers…")
+
+	// resync the model with the WAL, opening the batches that were loaded
+	resync := func(snapshots []transferSnapshot, err error) {
+		fyne.Do(func() {
+			if err != nil {
+				// rows missing from a partial snapshot may still be in the WAL
+				model.load(snapshots)
+				slog.Error("could not load transfers", "error", err)
+				status.SetText(err.Error())
+			} else {
+				model.resync(snapshots)
+				status.SetText("")
+			}
+
+			tree.Refresh()
+			for _, snapshot := range snapshots {
+				tree.OpenBranch(transferBatchNodeID(snapshot.id))
+			}
+		})
+	}
+
+	// apply an event to the model
+	apply := func(ev wal.Event) {
+		var destination string
+		if ev.Type == wal.BatchCreated {
+			if batch, err := uploads.batch(ev.BatchID); err == nil {
+				destination, _ = batch.Destination()
+			}
+		}
+
+		fyne.Do(func() {
+			model.apply(ev, destination)
+			if ev.Type == wal.BatchCreated {
+				tree.OpenBranch(transferBatchNodeID(ev.BatchID))
+			}
+		})
+	}
+
+	go func() {
+		// events that arrive while loading are applied afterwards, applying them twice is harmless
+		seenDropped := dropped()
+		resync(snapshotTransfers(uploads.wal))
+
+		ticker := time.NewTicker(transfersRefreshInterval)
+		defer ticker.Stop()
+
+		last := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				apply(ev)
+			case now := <-ticker.C:
+				// events were missed, rows could wait for them forever
+				if n := dropped(); n != seenDropped {
+					seenDropped = n
+					slog.Debug("transfers panel missed WAL events, reloading it", "dropped", n)
+
+					// events older than the snapshot must not be applied after it
+					if !drainEvents(events, apply) {
+						return
+					}
+					resync(snapshotTransfers(uploads.wal))
+				}
+
+				active := uploads.Active()
+				elapsed := now.Sub(last)
+				last = now
+
+				fyne.Do(func() {
+					model.updateProgress(active, elapsed)
+					tree.Refresh()
+				})
+			}
+		}
+	}()
+
+	w.SetContent(container.NewBorder(nil, status, nil, nil, tree))
+	w.Show()
+}
+
+// snapshotTransfers of the batches in writeAheadLog, the ones read before an error if there is one.
+func snapshotTransfers(writeAheadLog *wal.WriteAheadLog) ([]transferSnapshot, error) {
+	var snapshots []transferSnapshot
+	for batch, err := range writeAheadLog.Batches() {
+		if err != nil {
+			return snapshots, err
+		}
+
+		snapshot := transferSnapshot{id: batch.ID()}
+		snapshot.destination, err = batch.Destination()
+		if err != nil {
+			return snapshots, err
+		}
+
+		for item, err := range batch.UnfinishedItems() {
+			if err != nil {
+				return snapshots, err
+			}
+			snapshot.items = append(snapshot.items, item)
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// drainEvents buffered in events into apply, false if events was closed.
+func drainEvents(events <-chan wal.Event, apply func(wal.Event)) bool {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			apply(ev)
+		default:
+			return true
+		}
+	}
+}
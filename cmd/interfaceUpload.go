@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/ctII/filebrowserui/wal"
+)
+
+// conflictPolicyLabels shown to the user for every wal.ConflictPolicy.
+var conflictPolicyLabels = map[wal.ConflictPolicy]string{
+	wal.ConflictRename:    "Keep both, renaming the upload",
+	wal.ConflictSkip:      "Skip files that exist",
+	wal.ConflictOverwrite: "Overwrite files that exist",
+}
+
+// newConflictPolicyGroup to pick a wal.ConflictPolicy, defaulting to the first of wal.ConflictPolicies.
+func newConflictPolicyGroup() *widget.RadioGroup {
+	labels := make([]string, 0, len(wal.ConflictPolicies))
+	for _, policy := range wal.ConflictPolicies {
+		labels = append(labels, conflictPolicyLabels[policy])
+	}
+
+	group := widget.NewRadioGroup(labels, nil)
+	group.Required = true
+	group.SetSelected(conflictPolicyLabels[wal.ConflictPolicies[0]])
+
+	return group
+}
+
+// selectedConflictPolicy of a group made by newConflictPolicyGroup.
+func selectedConflictPolicy(group *widget.RadioGroup) wal.ConflictPolicy {
+	for policy, label := range conflictPolicyLabels {
+		if label == group.Selected {
+			return policy
+		}
+	}
+	return wal.ConflictPolicies[0]
+}
+
+// showUploadDialog in a new window, to pick local files and folders and upload them into a remote directory.
+// dest is the remote directory selected when the dialog opens and local the paths already added, like the ones handed off by another instance.
+func showUploadDialog(a fyne.App, sess *filebrowserSession, cache *NodeCache, uploads *uploadManager, dest string, local []string) {
+	w := a.NewWindow("Upload")
+	w.Resize(fyne.NewSize(800, 600))
+
+	var (
+		paths    = slices.Clone(local)
+		selected = -1
+	)
+
+	list := widget.NewList(
+		func() int { return len(paths) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			if id >= len(paths) {
+				return
+			}
+			o.(*widget.Label).SetText(strings.ReplaceAll(paths[id], "\n", "\\n"))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) { selected = id }
+	list.OnUnselected = func(_ widget.ListItemID) { selected = -1 }
+
+	add := func(p string) {
+		if p == "" || slices.Contains(paths, p) {
+			return
+		}
+		paths = append(paths, p)
+		list.Refresh()
+	}
+
+	typedPaths := widget.NewEntry()
+	typedPaths.SetPlaceHolder("Local path to add")
+	typedPaths.OnSubmitted = func(text string) {
+		add(strings.TrimSpace(text))
+		typedPaths.SetText("")
+	}
+
+	localButtons := container.NewHBox(
+		widget.NewButton("Add files…", func() {
+			dialog.ShowFileOpen(func(rc fyne.URIReadCloser, err error) {
+				if err != nil {
+					notify(w, notifyError, err.Error())
+					return
+				}
+				if rc == nil {
+					return
+				}
+				defer rc.Close()
+
+				add(rc.URI().Path())
+			}, w)
+		}),
+		widget.NewButton("Add folder…", func() {
+			dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+				if err != nil {
+					notify(w, notifyError, err.Error())
+					return
+				}
+				if dir == nil {
+					return
+				}
+
+				add(dir.Path())
+			}, w)
+		}),
+		widget.NewButton("Remove", func() {
+			if selected < 0 || selected >= len(paths) {
+				return
+			}
+			paths = removeIndexFromSlice(paths, selected)
+			list.UnselectAll()
+			list.Refresh()
+		}),
+	)
+
+	destination := widget.NewEntry()
+	destination.SetText(dest)
+
+	destinationRow := container.NewBorder(nil, nil, widget.NewLabel("Upload into"), widget.NewButton("Browse…", func() {
+		showRemoteFolderPicker(w, sess, cache, destination.Text, destination.SetText)
+	}), destination)
+
+	conflicts := newConflictPolicyGroup()
+
+	var uploadButton *widget.Button
+	uploadButton = widget.NewButton("Upload", func() {
+		if typed := strings.TrimSpace(typedPaths.Text); typed != "" {
+			add(typed)
+			typedPaths.SetText("")
+		}
+
+		if len(paths) == 0 {
+			notify(w, notifyInfo, "add files or folders to upload first")
+			return
+		}
+
+		dir := path.Clean("/" + strings.TrimSpace(destination.Text))
+
+		policy := selectedConflictPolicy(conflicts)
+		toUpload := slices.Clone(paths)
+
+		uploadButton.Disable()
+		go func() {
+			err := uploads.BeginUpload(dir, toUpload, policy)
+
+			fyne.Do(func() {
+				if err != nil {
+					uploadButton.Enable()
+					notify(w, notifyError, fmt.Sprintf("could not upload into (%v): %v", dir, err))
+					return
+				}
+				w.Close()
+			})
+		}()
+	})
+	uploadButton.Importance = widget.HighImportance
+
+	top := container.NewVBox(
+		widget.NewLabel("Files and folders to upload"),
+		container.NewBorder(nil, nil, nil, localButtons, typedPaths),
+	)
+
+	bottom := container.NewVBox(
+		destinationRow,
+		widget.NewLabel("When a file already exists"),
+		conflicts,
+		container.NewHBox(widget.NewButton("Cancel", w.Close), uploadButton),
+	)
+
+	w.SetOnClosed(func() { forgetToasts(w) })
+	w.SetContent(withToasts(w, container.NewBorder(top, bottom, nil, nil, list)))
+	w.Show()
+}
+
+// confirmDroppedUpload of paths dropped onto w into the remote directory dir, asking for the conflict policy first.
+func confirmDroppedUpload(w fyne.Window, uploads *uploadManager, dir string, paths []string) {
+	var modal *widget.PopUp
+
+	conflicts := newConflictPolicyGroup()
+
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, strings.ReplaceAll(p, "\n", "\\n"))
+	}
+
+	list := widget.NewMultiLineEntry()
+	list.SetText(strings.Join(names, "\n"))
+	list.OnChanged = func(_ string) {
+		list.SetText(strings.Join(names, "\n"))
+	}
+
+	upload := widget.NewButton("Upload", func() {
+		modal.Hide()
+
+		policy := selectedConflictPolicy(conflicts)
+		go func() {
+			if err := uploads.BeginUpload(dir, paths, policy); err != nil {
+				fyne.Do(func() { notify(w, notifyError, fmt.Sprintf("could not upload into (%v): %v", dir, err)) })
+			}
+		}()
+	})
+	upload.Importance = widget.HighImportance
+
+	content := container.New(&priorityVLayout{},
+		list,
+		container.NewVBox(
+			widget.NewLabel(fmt.Sprintf("Upload %v dropped items into %v", len(paths), strings.ReplaceAll(dir, "\n", "\\n"))),
+			widget.NewLabel("When a file already exists"),
+			conflicts,
+			container.NewCenter(container.NewHBox(widget.NewButton("Cancel", func() { modal.Hide() }), upload)),
+		),
+	)
+
+	modal = widget.NewModalPopUp(content, w.Canvas())
+	modal.Show()
+	modal.Resize(fyne.NewSize(w.Canvas().Size().Width, w.Canvas().Size().Height*2/3))
+}
+
+// showRemoteFolderPicker over w, calling chosen with the remote directory picked by the user.
+func showRemoteFolderPicker(w fyne.Window, sess *filebrowserSession, cache *NodeCache, start string, chosen func(dir string)) {
+	current := path.Clean("/" + start)
+
+	currentLabel := widget.NewLabel(current)
+
+	var tree *widget.Tree
+	loader := newTreeLoader(cache, true, func(id widget.TreeNodeID) { tree.RefreshItem(id) })
+
+	tree = widget.NewTree(
+		loader.children,
+		loader.isBranch,
+		func(_ bool) fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TreeNodeID, _ bool, o fyne.CanvasObject) {
+			if parent, isError, ok := treePlaceholder(id); ok {
+				if isError {
+					o.(*widget.Label).SetText("could not load: " + loader.errText(parent))
+				} else {
+					o.(*widget.Label).SetText("loading…")
+				}
+				return
+			}
+
+			name := path.Base(id)
+			if id == "/" {
+				name = "/"
+			}
+			o.(*widget.Label).SetText(strings.ReplaceAll(name, "\n", "\\n"))
+		},
+	)
+	tree.OnBranchOpened = loader.opened
+	tree.OnBranchClosed = loader.closed
+	tree.Root = "/"
+	loader.opened(tree.Root)
+	tree.OnSelected = func(id widget.TreeNodeID) {
+		// selecting a branch that failed to load retries it
+		if parent, isError, ok := treePlaceholder(id); ok {
+			tree.Unselect(id)
+			if isError {
+				loader.reload(parent)
+			}
+			return
+		}
+
+		current = id
+		currentLabel.SetText(strings.ReplaceAll(id, "\n", "\\n"))
+	}
+
+	var modal *widget.PopUp
+
+	newFolder := widget.NewButton("Create folder", func() {
+		name := widget.NewEntry()
+		name.Validator = func(s string) error {
+			if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\`) {
+				return errors.New("not a valid folder name")
+			}
+			return nil
+		}
+
+		parent := current
+		dialog.ShowForm("Create folder in "+parent, "Create", "Cancel", []*widget.FormItem{widget.NewFormItem("Name", name)}, func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			dir := path.Join(parent, name.Text)
+			go func() {
+				err := sess.CreateDirectory(context.Background(), dir)
+
+				fyne.Do(func() {
+					if err != nil {
+						notify(w, notifyError, fmt.Sprintf("could not create folder (%v): %v", dir, err))
+						return
+					}
+
+					loader.reload(parent)
+					tree.OpenBranch(parent)
+					tree.Select(dir)
+				})
+			}()
+		}, w)
+	})
+	if !sess.can(permCreate) {
+		newFolder.Disable()
+	}
+
+	buttons := container.NewHBox(
+		newFolder,
+		widget.NewButton("Cancel", func() {
+			modal.Hide()
+			loader.close()
+		}),
+		widget.NewButton("Select", func() {
+			modal.Hide()
+			loader.close()
+			chosen(current)
+		}),
+	)
+
+	content := container.NewBorder(currentLabel, container.NewCenter(buttons), nil, nil, tree)
+
+	modal = widget.NewModalPopUp(content, w.Canvas())
+	modal.Show()
+	modal.Resize(w.Canvas().Size().Subtract(fyne.NewSize(40, 40)))
+
+	// open the branches down to the starting directory
+	for dir := current; ; dir = path.Dir(dir) {
+		tree.OpenBranch(dir)
+		if dir == "/" {
+			break
+		}
+	}
+	tree.Select(current)
+}
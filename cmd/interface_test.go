@@ -0,0 +1,41 @@
+package cmd
+
+import "testing"
+
+func TestTreeRowDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		row  treeRow
+		want string
+	}{
+		{treeRow{id: "", branch: true}, "/"},
+		{treeRow{id: "/photos", branch: true}, "/photos"},
+		{treeRow{id: "/photos/a.jpg"}, "/photos"},
+		{treeRow{id: "/a.jpg"}, "/"},
+		{treeRow{id: treeLoadingID("/photos")}, "/photos"},
+		{treeRow{id: treeErrorID("")}, "/"},
+	}
+
+	for _, test := range tests {
+		if got := test.row.dir(); got != test.want {
+			t.Errorf("%+v.dir() = %v, want %v", test.row, got, test.want)
+		}
+	}
+}
+
+func TestTreeParentID(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"/a":     "",
+		"/a/b":   "/a",
+		"/a/b/c": "/a/b",
+	}
+
+	for id, want := range tests {
+		if got := treeParentID(id); got != want {
+			t.Errorf("treeParentID(%v) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -1,44 +1,675 @@
 package cmd
 
 import (
+	"container/list"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-
-	"github.com/simplylib/genericsync"
+	"path"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Node struct {
 	*Resource
+
+	// fetched is when filebrowser answered with Resource
+	fetched time.Time
+
+	// checked is when Resource was last fetched, or tried to be, from filebrowser. Zero if restored and not tried yet.
+	checked time.Time
+
+	// restored from the offline cache and not fetched again yet
+	restored bool
+
+	// offline is true if fetching it again failed
+	offline bool
+}
+
+// nodeFreshness of a cached resource.
+type nodeFreshness uint8
+
+const (
+	nodeFresh nodeFreshness = iota
+	// nodeRestored was restored from the offline cache and is being fetched again
+	nodeRestored
+	// nodeOffline could not be fetched again from filebrowser
+	nodeOffline
+)
+
+// maxCachedChecksums remembered by a NodeCache, others are forgotten to remember new ones.
+const maxCachedChecksums = 1000
+
+// nodeChecksum of a file, calculated while it was last modified at modified and had size.
+type nodeChecksum struct {
+	sum      string
+	modified time.Time
+	size     int
+}
+
+// nodeCacheCall is a request to filebrowser shared by everyone asking for the same path.
+type nodeCacheCall struct {
+	done chan struct{}
+	res  *Resource
+	err  error
+
+	// waiters still waiting on done, the request is cancelled when all of them gave up
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// NodeCacheOptions of a NodeCache, zero values have no limit.
+type NodeCacheOptions struct {
+	// TTL of a cached resource before it is revalidated
+	TTL time.Duration
+
+	// MaxEntries cached before the least recently used are evicted
+	MaxEntries int
+
+	// MaxBytes is the approximate memory of cached resources before the least recently used are evicted
+	MaxBytes int64
+
+	// Prefetch is how many subdirectories of a directory are fetched by Prefetch, 0 doesn't prefetch
+	Prefetch int
+
+	// PrefetchConcurrency is how many directories are prefetched at once, at least 1
+	PrefetchConcurrency int
+}
+
+// NodeCacheStats of a NodeCache, for debugging.
+type NodeCacheStats struct {
+	Entries int
+	Bytes   int64
+	Pinned  int
+
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+func (s NodeCacheStats) String() string {
+	return fmt.Sprintf("node cache: %v entries (%v, %v pinned), %v hits, %v misses, %v evictions",
+		s.Entries, formatBytes(s.Bytes), s.Pinned, s.Hits, s.Misses, s.Evictions)
+}
+
+// nodeCacheEntry of the LRU list of a NodeCache.
+type nodeCacheEntry struct {
+	key  string
+	node Node
+	cost int64
 }
 
-// NodeCache is a non-optimal cache that does cache things
-// but sometimes multiple requests for the same object will result in
-// multiple filebrowser request, but eventually will keep them in cache
+// NodeCache caches resources of filebrowser, concurrent requests for the same path share one request.
+// Resources older than the TTL are still returned, but fetched again in the background.
+// Once over its limits the least recently used resources are evicted, except pinned ones.
 type NodeCache struct {
 	sess *filebrowserSession
+	opts NodeCacheOptions
+
+	// now is time.Now, replaced by tests
+	now func() time.Time
+
+	mu    sync.Mutex
+	calls map[string]*nodeCacheCall
+
+	listeners    map[int]func(path string)
+	nextListener int
+
+	// entries by key, lru holds them most recently used first
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int64
+
+	// pinned keys and how many times, they are never evicted
+	pinned map[string]int
+
+	// offline is true while filebrowser can't be reached
+	offline bool
+
+	// persist a fetched resource into the offline cache, nil if there is none
+	persist func(key string, res *Resource, fetched time.Time)
+
+	// unpersist the resources of prefix and below it from the offline cache, nil if there is none
+	unpersist func(prefix string)
+
+	// prefetchSlots limits how many directories are prefetched at once
+	prefetchSlots chan struct{}
 
-	// Cache of map[ID string]Node
-	cache genericsync.Map[string, Node]
+	// checksums of files by key
+	checksums map[string]nodeChecksum
+
+	hits, misses, evictions uint64
+}
+
+func NewNodeCache(sess *filebrowserSession, opts NodeCacheOptions) *NodeCache {
+	return &NodeCache{
+		sess:      sess,
+		opts:      opts,
+		now:       time.Now,
+		calls:     make(map[string]*nodeCacheCall),
+		listeners: make(map[int]func(path string)),
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		pinned:    make(map[string]int),
+
+		prefetchSlots: make(chan struct{}, max(1, opts.PrefetchConcurrency)),
+		checksums:     make(map[string]nodeChecksum),
+	}
+}
+
+// resourceCost is roughly how many bytes res takes in memory.
+func resourceCost(res *Resource) int64 {
+	const (
+		resourceOverhead = 256
+		itemOverhead     = 128
+	)
+
+	cost := int64(resourceOverhead + len(res.Path) + len(res.Name) + len(res.Extension) + len(res.Type))
+	for i := range res.Items {
+		item := &res.Items[i]
+		cost += int64(itemOverhead + len(item.Path) + len(item.Name) + len(item.Extension) + len(item.Type))
+	}
+
+	return cost
 }
 
-func NewNodeCache(sess *filebrowserSession) *NodeCache {
-	return &NodeCache{sess: sess}
+// load key from the cache, marking it as most recently used. nc.mu must be held.
+func (nc *NodeCache) load(key string) (Node, bool) {
+	e, ok := nc.entries[key]
+	if !ok {
+		return Node{}, false
+	}
+
+	nc.lru.MoveToFront(e)
+	return e.Value.(*nodeCacheEntry).node, true
 }
 
-func (nc *NodeCache) Info(ctx context.Context, path string) (*Resource, error) {
-	node, ok := nc.cache.Load(path)
+// store node as key, evicting the least recently used unpinned entries while over the limits. nc.mu must be held.
+func (nc *NodeCache) store(key string, node Node) {
+	cost := resourceCost(node.Resource)
+
+	if e, ok := nc.entries[key]; ok {
+		entry := e.Value.(*nodeCacheEntry)
+		nc.bytes += cost - entry.cost
+		entry.node, entry.cost = node, cost
+		nc.lru.MoveToFront(e)
+	} else {
+		nc.entries[key] = nc.lru.PushFront(&nodeCacheEntry{key: key, node: node, cost: cost})
+		nc.bytes += cost
+	}
+
+	over := func() bool {
+		return nc.opts.MaxEntries > 0 && len(nc.entries) > nc.opts.MaxEntries ||
+			nc.opts.MaxBytes > 0 && nc.bytes > nc.opts.MaxBytes
+	}
+
+	for e := nc.lru.Back(); e != nil && over(); {
+		prev := e.Prev()
+
+		entry := e.Value.(*nodeCacheEntry)
+		if nc.pinned[entry.key] == 0 && entry.key != key {
+			nc.remove(entry.key)
+			nc.evictions++
+			slog.Debug("evicted resource info from cache", "path", entry.key)
+		}
+
+		e = prev
+	}
+}
+
+// remove key from the cache. nc.mu must be held.
+func (nc *NodeCache) remove(key string) {
+	e, ok := nc.entries[key]
+	if !ok {
+		return
+	}
+
+	nc.bytes -= e.Value.(*nodeCacheEntry).cost
+	nc.lru.Remove(e)
+	delete(nc.entries, key)
+}
+
+// Pin path so it is never evicted until unpinned as many times, like while it is expanded in a tree.
+func (nc *NodeCache) Pin(p string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.pinned[nodeKey(p)]++
+}
+
+// Unpin path pinned by Pin.
+func (nc *NodeCache) Unpin(p string) {
+	key := nodeKey(p)
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if nc.pinned[key]--; nc.pinned[key] <= 0 {
+		delete(nc.pinned, key)
+	}
+}
+
+// Stats of the cache.
+func (nc *NodeCache) Stats() NodeCacheStats {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	return NodeCacheStats{
+		Entries:   len(nc.entries),
+		Bytes:     nc.bytes,
+		Pinned:    len(nc.pinned),
+		Hits:      nc.hits,
+		Misses:    nc.misses,
+		Evictions: nc.evictions,
+	}
+}
+
+// nodeKey of p in the cache, so "", "/" and "/a/" are the same as the paths filebrowser lists.
+func nodeKey(p string) string {
+	return path.Clean("/" + p)
+}
+
+func (nc *NodeCache) Info(ctx context.Context, p string) (*Resource, error) {
+	key := nodeKey(p)
+
+	nc.mu.Lock()
+	node, ok := nc.load(key)
 	if ok {
+		nc.hits++
+		nc.mu.Unlock()
+
+		if node.checked.IsZero() || nc.opts.TTL > 0 && nc.now().Sub(node.checked) > nc.opts.TTL {
+			nc.revalidate(key)
+		}
 		return node.Resource, nil
 	}
+	nc.misses++
 
-	slog.Debug("cache miss, calling filebrowser", "path", path)
-	res, err := nc.sess.Info(ctx, path)
+	slog.Debug("cache miss, calling filebrowser", "path", key)
+
+	call, ok := nc.calls[key]
+	if !ok {
+		call = nc.fetch(key)
+	}
+	call.waiters++
+	nc.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.res, call.err
+	case <-ctx.Done():
+		nc.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if nc.calls[key] == call {
+				delete(nc.calls, key)
+			}
+		}
+		nc.mu.Unlock()
+
+		return nil, context.Cause(ctx)
+	}
+}
+
+// fetch key from filebrowser in the background, storing it in the cache unless invalidated meanwhile.
+// nc.mu must be held.
+func (nc *NodeCache) fetch(key string) *nodeCacheCall {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	call := &nodeCacheCall{done: make(chan struct{}), cancel: cancel}
+	nc.calls[key] = call
+
+	go func() {
+		defer cancel()
+
+		res, err := nc.sess.Info(ctx, key)
+
+		nc.mu.Lock()
+		if nc.calls[key] == call {
+			delete(nc.calls, key)
+
+			if err == nil {
+				now := nc.now()
+				nc.store(key, Node{Resource: res, fetched: now, checked: now})
+				slog.Debug("caching resource info", "path", key)
+
+				if nc.persist != nil {
+					nc.persist(key, res, now)
+				}
+			}
+		}
+
+		switch {
+		case err == nil:
+			nc.offline = false
+		case isConnectivityError(err):
+			nc.offline = true
+		}
+		call.res, call.err = res, err
+		nc.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// revalidate the stale key in the background, telling the listeners once it was fetched again or failed to be.
+func (nc *NodeCache) revalidate(key string) {
+	nc.mu.Lock()
+	if _, ok := nc.calls[key]; ok {
+		nc.mu.Unlock()
+		return
+	}
+
+	call := nc.fetch(key)
+	call.waiters++
+	nc.mu.Unlock()
+
+	slog.Debug("revalidating stale resource info", "path", key)
+
+	go func() {
+		<-call.done
+
+		// the parent lists what's gone, it's revalidated too so it stops listing it
+		revalidateParent := false
+
+		nc.mu.Lock()
+		switch {
+		case call.err == nil:
+		case errors.Is(call.err, ErrResourceNotFound):
+			slog.Debug("revalidated resource is gone, dropping it", "path", key)
+
+			nc.remove(key)
+			delete(nc.checksums, key)
+			if nc.unpersist != nil {
+				nc.unpersist(key)
+			}
+
+			_, parentCached := nc.entries[path.Dir(key)]
+			revalidateParent = key != "/" && parentCached
+		default:
+			slog.Warn("could not revalidate resource info, keeping the stale one", "path", key, "error", call.err)
+
+			// don't ask filebrowser again until the TTL passed again
+			if e, ok := nc.entries[key]; ok {
+				node := &e.Value.(*nodeCacheEntry).node
+				node.checked = nc.now()
+				node.offline = isConnectivityError(call.err)
+			}
+		}
+
+		listeners := make([]func(string), 0, len(nc.listeners))
+		for _, listener := range nc.listeners {
+			listeners = append(listeners, listener)
+		}
+		nc.mu.Unlock()
+
+		for _, listener := range listeners {
+			listener(key)
+		}
+
+		if revalidateParent {
+			nc.revalidate(path.Dir(key))
+		}
+	}()
+}
+
+// OnRevalidated calls f with the path of every stale resource after it was fetched again or failed to be, on its own goroutine.
+func (nc *NodeCache) OnRevalidated(f func(path string)) (unsubscribe func()) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	id := nc.nextListener
+	nc.nextListener++
+	nc.listeners[id] = f
+
+	return func() {
+		nc.mu.Lock()
+		defer nc.mu.Unlock()
+
+		delete(nc.listeners, id)
+	}
+}
+
+// Freshness of the cached resource of path, and when filebrowser answered with it. nodeFresh if it isn't cached.
+func (nc *NodeCache) Freshness(p string) (nodeFreshness, time.Time) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	e, ok := nc.entries[nodeKey(p)]
+	if !ok {
+		return nodeFresh, time.Time{}
+	}
+
+	node := e.Value.(*nodeCacheEntry).node
+	switch {
+	case node.offline:
+		return nodeOffline, node.fetched
+	case node.restored:
+		return nodeRestored, node.fetched
+	default:
+		return nodeFresh, node.fetched
+	}
+}
+
+// Offline is true while filebrowser can't be reached.
+func (nc *NodeCache) Offline() bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	return nc.offline
+}
+
+// Restore the listings of scope from the offline cache, and persist the ones fetched from now on into it.
+// Restored listings are returned by Info right away, while they're fetched again in the background.
+func (nc *NodeCache) Restore(oc *offlineCache, scope string) error {
+	entries, err := oc.load(scope, nc.now())
+	if err != nil {
+		return fmt.Errorf("could not restore node cache: %w", err)
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for _, entry := range entries {
+		key := nodeKey(entry.Path)
+		if _, ok := nc.entries[key]; ok {
+			continue
+		}
+		nc.store(key, Node{Resource: entry.Resource, fetched: entry.Fetched, restored: true})
+	}
+
+	nc.persist = func(key string, res *Resource, fetched time.Time) {
+		oc.put(scope, key, res, fetched)
+	}
+	nc.unpersist = func(prefix string) {
+		oc.delete(scope, prefix)
+	}
+
+	slog.Debug("restored node cache", "entries", len(entries))
+
+	return nil
+}
+
+// RevalidateEvery interval the pinned resources that were restored or couldn't be fetched again, until ctx is done.
+// That way what's shown catches up once filebrowser can be reached again.
+func (nc *NodeCache) RevalidateEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var keys []string
+
+		nc.mu.Lock()
+		for key := range nc.pinned {
+			if e, ok := nc.entries[key]; ok && (e.Value.(*nodeCacheEntry).node.offline || e.Value.(*nodeCacheEntry).node.restored) {
+				keys = append(keys, key)
+			}
+		}
+		nc.mu.Unlock()
+
+		for _, key := range keys {
+			nc.revalidate(key)
+		}
+	}
+}
+
+// Prefetch the listings of the first subdirectories of the directory res in the background, until ctx is done.
+// Only the ones that aren't cached yet are fetched.
+func (nc *NodeCache) Prefetch(ctx context.Context, res *Resource) {
+	if nc.opts.Prefetch <= 0 {
+		return
+	}
+
+	var dirs []string
+
+	nc.mu.Lock()
+	for i := range res.Items {
+		if len(dirs) == nc.opts.Prefetch {
+			break
+		}
+
+		if !res.Items[i].IsDir {
+			continue
+		}
+
+		key := nodeKey(res.Items[i].Path)
+		if _, ok := nc.entries[key]; !ok {
+			dirs = append(dirs, key)
+		}
+	}
+	nc.mu.Unlock()
+
+	if len(dirs) == 0 {
+		return
+	}
+
+	go func() {
+		for _, dir := range dirs {
+			select {
+			case nc.prefetchSlots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			if ctx.Err() != nil {
+				<-nc.prefetchSlots
+				return
+			}
+
+			go func() {
+				defer func() { <-nc.prefetchSlots }()
+
+				slog.Debug("prefetching resource info", "path", dir)
+				if _, err := nc.Info(ctx, dir); err != nil && ctx.Err() == nil {
+					slog.Debug("could not prefetch resource info", "path", dir, "error", err)
+				}
+			}()
+		}
+	}()
+}
+
+// SHA256 of the file p calculated by filebrowser, remembered until the file is modified.
+func (nc *NodeCache) SHA256(ctx context.Context, p string) (string, error) {
+	key := nodeKey(p)
+
+	res, err := nc.Info(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if sum, ok := nc.CachedSHA256(res); ok {
+		return sum, nil
+	}
+
+	sum, err := nc.sess.SHA256(ctx, key)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	nc.cache.Store(path, Node{Resource: res})
-	slog.Debug("caching resource info", "path", path)
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if _, ok := nc.checksums[key]; !ok && len(nc.checksums) >= maxCachedChecksums {
+		for forget := range nc.checksums {
+			delete(nc.checksums, forget)
+			break
+		}
+	}
+	nc.checksums[key] = nodeChecksum{sum: sum, modified: res.Modified, size: res.Size}
 
-	return res, nil
+	return sum, nil
+}
+
+// CachedSHA256 of the file res, if it was calculated since res was last modified.
+func (nc *NodeCache) CachedSHA256(res *Resource) (string, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	checksum, ok := nc.checksums[nodeKey(res.Path)]
+	if !ok || !checksum.modified.Equal(res.Modified) || checksum.size != res.Size {
+		return "", false
+	}
+	return checksum.sum, true
+}
+
+// Invalidate the cached resource of path, so the next Info asks filebrowser again.
+func (nc *NodeCache) Invalidate(p string) {
+	key := nodeKey(p)
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.remove(key)
+	// a request already on its way may have been answered before the change
+	delete(nc.calls, key)
+}
+
+// Forget p, a path that was deleted or moved away, and everything below it, also in the offline cache.
+func (nc *NodeCache) Forget(p string) {
+	key := nodeKey(p)
+
+	nc.InvalidateTree(key)
+
+	nc.mu.Lock()
+	unpersist := nc.unpersist
+	nc.mu.Unlock()
+
+	if unpersist != nil {
+		unpersist(key)
+	}
+}
+
+// InvalidateTree of prefix, the cached resources of prefix and everything below it.
+func (nc *NodeCache) InvalidateTree(prefix string) {
+	prefix = nodeKey(prefix)
+
+	under := func(key string) bool {
+		return prefix == "/" || key == prefix || strings.HasPrefix(key, prefix+"/")
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	for key := range nc.entries {
+		if under(key) {
+			nc.remove(key)
+		}
+	}
+
+	for key := range nc.calls {
+		if under(key) {
+			delete(nc.calls, key)
+		}
+	}
 }
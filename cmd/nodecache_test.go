@@ -0,0 +1,475 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestResourceServer answering every resource with its path and how many times it was asked for as its name.
+// block is waited on before answering if it isn't nil.
+func newTestResourceServer(t *testing.T, block <-chan struct{}) (*httptest.Server, *sync.Map) {
+	t.Helper()
+
+	var hits sync.Map
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/api/resources")
+
+		n, _ := hits.LoadOrStore(p, new(atomic.Int64))
+		hit := n.(*atomic.Int64).Add(1)
+
+		if block != nil {
+			select {
+			case <-block:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, `{"path":%q,"name":"%v","isDir":true}`, p, hit)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &hits
+}
+
+func resourceHits(hits *sync.Map, p string) int64 {
+	n, ok := hits.Load(p)
+	if !ok {
+		return 0
+	}
+	return n.(*atomic.Int64).Load()
+}
+
+func TestNodeCacheCoalescing(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan struct{})
+	srv, hits := newTestResourceServer(t, block)
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{})
+
+	const callers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := nc.Info(context.Background(), "/d/")
+			if err == nil && res.Name != "1" {
+				err = fmt.Errorf("expected the first answer, got (%v)", res.Name)
+			}
+			errs <- err
+		}()
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); resourceHits(hits, "/d") == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := resourceHits(hits, "/d"); n != 1 {
+		t.Fatalf("expected concurrent requests to share 1 request, got (%v)", n)
+	}
+}
+
+func TestNodeCacheCancel(t *testing.T) {
+	t.Parallel()
+
+	srv, hits := newTestResourceServer(t, make(chan struct{}))
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for resourceHits(hits, "/slow") == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	if _, err := nc.Info(ctx, "/slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got (%v)", err)
+	}
+
+	// the request was dropped with its last waiter, so the next one asks again
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _ = nc.Info(ctx, "/slow")
+
+	if n := resourceHits(hits, "/slow"); n != 2 {
+		t.Fatalf("expected a new request after the first was cancelled, got (%v) requests", n)
+	}
+}
+
+func TestNodeCacheStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	srv, hits := newTestResourceServer(t, nil)
+
+	var elapsed atomic.Int64
+	start := time.Now()
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{TTL: time.Minute})
+	nc.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+
+	revalidated := make(chan string, 1)
+	unsubscribe := nc.OnRevalidated(func(p string) { revalidated <- p })
+	defer unsubscribe()
+
+	res, err := nc.Info(context.Background(), "/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "1" {
+		t.Fatalf("expected the first answer, got (%v)", res.Name)
+	}
+
+	if res, _ = nc.Info(context.Background(), "/d"); res.Name != "1" || resourceHits(hits, "/d") != 1 {
+		t.Fatal("expected a fresh resource to come from the cache")
+	}
+
+	elapsed.Store(int64(2 * time.Minute))
+
+	if res, _ = nc.Info(context.Background(), "/d"); res.Name != "1" {
+		t.Fatalf("expected the stale resource while revalidating, got (%v)", res.Name)
+	}
+
+	select {
+	case p := <-revalidated:
+		if p != "/d" {
+			t.Fatalf("expected /d to be revalidated, got (%v)", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the revalidation")
+	}
+
+	if res, _ = nc.Info(context.Background(), "/d"); res.Name != "2" {
+		t.Fatalf("expected the revalidated resource, got (%v)", res.Name)
+	}
+}
+
+func TestNodeCacheRevalidateGone(t *testing.T) {
+	t.Parallel()
+
+	var gone atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/api/resources")
+		switch {
+		case gone.Load() && p == "/d":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case gone.Load() && p == "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"path":%q,"isDir":true}`, p)
+	}))
+	defer srv.Close()
+
+	var elapsed atomic.Int64
+	start := time.Now()
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{TTL: time.Minute})
+	nc.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+
+	revalidated := make(chan string, 8)
+	unsubscribe := nc.OnRevalidated(func(p string) { revalidated <- p })
+	defer unsubscribe()
+
+	for _, p := range []string{"/", "/d", "/forbidden"} {
+		if _, err := nc.Info(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	elapsed.Store(int64(2 * time.Minute))
+	gone.Store(true)
+
+	waitRevalidated := func(want string) {
+		t.Helper()
+
+		for {
+			select {
+			case p := <-revalidated:
+				if p == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for (%v) to be revalidated", want)
+			}
+		}
+	}
+
+	// the parent of what's gone is revalidated after it
+	_, _ = nc.Info(context.Background(), "/d")
+	waitRevalidated("/d")
+	waitRevalidated("/")
+
+	if _, fetched := nc.Freshness("/d"); !fetched.IsZero() {
+		t.Fatal("expected the resource that's gone to be dropped from the cache")
+	}
+
+	_, _ = nc.Info(context.Background(), "/forbidden")
+	waitRevalidated("/forbidden")
+
+	if freshness, _ := nc.Freshness("/forbidden"); freshness == nodeOffline || nc.Offline() {
+		t.Fatal("expected a forbidden resource not to be shown as offline")
+	}
+}
+
+func TestNodeCacheInvalidateTree(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newTestResourceServer(t, nil)
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{})
+
+	for _, p := range []string{"", "/a", "/a/b", "/ab"} {
+		if _, err := nc.Info(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cached := func(p string) bool {
+		nc.mu.Lock()
+		defer nc.mu.Unlock()
+
+		_, ok := nc.entries[p]
+		return ok
+	}
+
+	nc.InvalidateTree("/a/")
+	if cached("/a") || cached("/a/b") || !cached("/ab") || !cached("/") {
+		t.Fatal("expected only /a and below to be invalidated")
+	}
+
+	nc.Invalidate("")
+	if cached("/") || !cached("/ab") {
+		t.Fatal("expected only the root to be invalidated")
+	}
+
+	nc.InvalidateTree("/")
+	if cached("/ab") {
+		t.Fatal("expected everything to be invalidated")
+	}
+}
+
+func TestNodeCacheLRU(t *testing.T) {
+	t.Parallel()
+
+	srv, hits := newTestResourceServer(t, nil)
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{MaxEntries: 3})
+
+	info := func(p string) {
+		t.Helper()
+		if _, err := nc.Info(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nc.Pin("/pinned")
+	info("/pinned")
+	info("/a")
+	info("/b")
+
+	// /a is used more recently than /b, so /b is evicted, and /pinned never is
+	info("/a")
+	info("/c")
+	info("/d")
+
+	stats := nc.Stats()
+	if stats.Entries != 3 || stats.Evictions != 2 || stats.Pinned != 1 {
+		t.Fatalf("expected 3 entries, 2 evictions and 1 pinned, got (%+v)", stats)
+	}
+
+	if stats.Hits != 1 || stats.Misses != 5 {
+		t.Fatalf("expected 1 hit and 5 misses, got (%+v)", stats)
+	}
+
+	info("/pinned")
+	info("/d")
+	if resourceHits(hits, "/pinned") != 1 || resourceHits(hits, "/d") != 1 {
+		t.Fatal("expected /pinned and /d to still be cached")
+	}
+
+	info("/b")
+	if resourceHits(hits, "/b") != 2 {
+		t.Fatal("expected /b to have been evicted")
+	}
+
+	nc.Unpin("/pinned")
+	info("/e")
+	info("/f")
+	info("/g")
+	if stats := nc.Stats(); stats.Pinned != 0 || stats.Entries != 3 {
+		t.Fatalf("expected nothing pinned and 3 entries, got (%+v)", stats)
+	}
+
+	info("/pinned")
+	if resourceHits(hits, "/pinned") != 2 {
+		t.Fatal("expected /pinned to be evicted once unpinned")
+	}
+}
+
+func TestNodeCacheMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newTestResourceServer(t, nil)
+
+	res := &Resource{Path: "/a", Name: "1", IsDir: true}
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{MaxBytes: 2*resourceCost(res) + 1})
+
+	for _, p := range []string{"/a", "/b", "/c"} {
+		if _, err := nc.Info(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := nc.Stats(); stats.Entries != 2 || stats.Evictions != 1 || stats.Bytes > 2*resourceCost(res)+1 {
+		t.Fatalf("expected 2 entries within the byte limit, got (%+v)", stats)
+	}
+}
+
+// testListing of dir with items, a path ending in / is a directory.
+func testListing(dir string, items ...string) *Resource {
+	res := &Resource{Path: dir, IsDir: true}
+	res.Items = make([]ResourceItem, len(items))
+	for i, item := range items {
+		res.Items[i].Path, res.Items[i].IsDir = strings.TrimSuffix(item, "/"), strings.HasSuffix(item, "/")
+	}
+	return res
+}
+
+func TestNodeCachePrefetch(t *testing.T) {
+	t.Parallel()
+
+	srv, hits := newTestResourceServer(t, nil)
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{Prefetch: 2, PrefetchConcurrency: 1})
+
+	if _, err := nc.Info(context.Background(), "/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	nc.Prefetch(context.Background(), testListing("/", "/a/", "/f", "/b/", "/c/", "/d/"))
+
+	for deadline := time.Now().Add(5 * time.Second); nc.Stats().Entries != 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the prefetch, got (%+v)", nc.Stats())
+		}
+	}
+
+	// the cached directory and the file are skipped, the first 2 other directories are fetched
+	for p, want := range map[string]int64{"/a": 1, "/f": 0, "/b": 1, "/c": 1, "/d": 0} {
+		if got := resourceHits(hits, p); got != want {
+			t.Errorf("expected (%v) to be fetched (%v) times, got (%v)", p, want, got)
+		}
+	}
+}
+
+func TestNodeCachePrefetchCancel(t *testing.T) {
+	t.Parallel()
+
+	block := make(chan struct{})
+	defer close(block)
+	srv, hits := newTestResourceServer(t, block)
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{Prefetch: 2, PrefetchConcurrency: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	nc.Prefetch(ctx, testListing("/", "/a/", "/b/"))
+
+	for deadline := time.Now().Add(5 * time.Second); resourceHits(hits, "/a") == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the prefetch to start")
+		}
+	}
+
+	if resourceHits(hits, "/b") != 0 {
+		t.Fatal("expected only 1 directory to be prefetched at once")
+	}
+
+	cancel()
+
+	for deadline := time.Now().Add(5 * time.Second); len(nc.prefetchSlots) != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the prefetch to be cancelled")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if resourceHits(hits, "/b") != 0 || nc.Stats().Entries != 0 {
+		t.Fatalf("expected the cancelled prefetch to stop, got (%+v)", nc.Stats())
+	}
+}
+
+func TestNodeCacheSHA256(t *testing.T) {
+	t.Parallel()
+
+	var sums atomic.Int64
+	modified := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("checksum") == "sha256" {
+			_, _ = fmt.Fprintf(w, `{"checksums":{"sha256":"sum%v"}}`, sums.Add(1))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"path":"/f","name":"f","size":10,"modified":%q}`, modified.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{})
+
+	res, err := nc.Info(context.Background(), "/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := nc.CachedSHA256(res); ok {
+		t.Fatal("expected no checksum before it was calculated")
+	}
+
+	for range 2 {
+		sum, err := nc.SHA256(context.Background(), "/f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum != "sum1" {
+			t.Fatalf("expected the checksum to be calculated once, got (%v)", sum)
+		}
+	}
+
+	if sum, ok := nc.CachedSHA256(res); !ok || sum != "sum1" {
+		t.Fatalf("expected the cached checksum, got (%v, %v)", sum, ok)
+	}
+
+	modifiedRes := *res
+	modifiedRes.Modified = modified.Add(time.Minute)
+	if _, ok := nc.CachedSHA256(&modifiedRes); ok {
+		t.Fatal("expected no checksum of a file modified since it was calculated")
+	}
+}
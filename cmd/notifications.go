@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxNotifications kept by a notificationCenter, older ones are dropped.
+const maxNotifications = 500
+
+// notificationLevel of how much a notification matters.
+type notificationLevel uint8
+
+const (
+	notifyInfo notificationLevel = iota
+	notifyError
+)
+
+func (l notificationLevel) String() string {
+	if l == notifyError {
+		return "error"
+	}
+	return "info"
+}
+
+// notification shown to the user.
+type notification struct {
+	Time    time.Time
+	Level   notificationLevel
+	Message string
+}
+
+// String of n with a local timestamp, for copying.
+func (n notification) String() string {
+	return fmt.Sprintf("%v %v: %v", n.Time.Local().Format(time.DateTime), n.Level, n.Message)
+}
+
+// notificationCenter keeps the recent notifications of the application and how many errors are unseen.
+type notificationCenter struct {
+	mu sync.Mutex
+
+	// entries oldest first
+	entries []notification
+
+	unseenErrors int
+
+	listeners    map[int]func(notification)
+	nextListener int
+}
+
+func newNotificationCenter() *notificationCenter {
+	return &notificationCenter{listeners: make(map[int]func(notification))}
+}
+
+// add a notification and tell the listeners about it.
+func (nc *notificationCenter) add(level notificationLevel, message string) notification {
+	n := notification{Time: time.Now(), Level: level, Message: message}
+
+	nc.mu.Lock()
+	nc.entries = append(nc.entries, n)
+	if len(nc.entries) > maxNotifications {
+		nc.entries = slices.Delete(nc.entries, 0, len(nc.entries)-maxNotifications)
+	}
+	if level == notifyError {
+		nc.unseenErrors++
+	}
+
+	listeners := make([]func(notification), 0, len(nc.listeners))
+	for _, listener := range nc.listeners {
+		listeners = append(listeners, listener)
+	}
+	nc.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(n)
+	}
+
+	return n
+}
+
+// list of the notifications, newest first.
+func (nc *notificationCenter) list() []notification {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	list := slices.Clone(nc.entries)
+	slices.Reverse(list)
+	return list
+}
+
+// unseen errors since the last markSeen.
+func (nc *notificationCenter) unseen() int {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	return nc.unseenErrors
+}
+
+// markSeen every error so far.
+func (nc *notificationCenter) markSeen() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.unseenErrors = 0
+}
+
+// clear every notification.
+func (nc *notificationCenter) clear() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.entries = nil
+	nc.unseenErrors = 0
+}
+
+// subscribe f to every added notification, f is called on the goroutine adding it.
+func (nc *notificationCenter) subscribe(f func(notification)) (unsubscribe func()) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	id := nc.nextListener
+	nc.nextListener++
+	nc.listeners[id] = f
+
+	return func() {
+		nc.mu.Lock()
+		defer nc.mu.Unlock()
+
+		delete(nc.listeners, id)
+	}
+}
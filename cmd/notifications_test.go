@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNotificationCenter(t *testing.T) {
+	t.Parallel()
+
+	nc := newNotificationCenter()
+
+	var got []notification
+	unsubscribe := nc.subscribe(func(n notification) { got = append(got, n) })
+
+	nc.add(notifyInfo, "first")
+	nc.add(notifyError, "second")
+	nc.add(notifyError, "third")
+
+	if len(got) != 3 || got[2].Message != "third" {
+		t.Fatalf("expected the subscriber to get 3 notifications, got (%+v)", got)
+	}
+
+	if unseen := nc.unseen(); unseen != 2 {
+		t.Fatalf("expected 2 unseen errors, got (%v)", unseen)
+	}
+
+	list := nc.list()
+	if len(list) != 3 || list[0].Message != "third" || list[2].Message != "first" {
+		t.Fatalf("expected newest first, got (%+v)", list)
+	}
+
+	if s := list[1].String(); !strings.Contains(s, "error: second") {
+		t.Fatalf("expected level and message in (%v)", s)
+	}
+
+	nc.markSeen()
+	if unseen := nc.unseen(); unseen != 0 {
+		t.Fatalf("expected no unseen errors after marking them seen, got (%v)", unseen)
+	}
+
+	unsubscribe()
+	nc.add(notifyInfo, "unsubscribed")
+	if len(got) != 3 {
+		t.Fatalf("expected no notifications after unsubscribing, got (%v)", len(got))
+	}
+
+	nc.clear()
+	if list := nc.list(); len(list) != 0 {
+		t.Fatalf("expected no notifications after clearing, got (%v)", len(list))
+	}
+}
+
+func TestNotificationCenterLimit(t *testing.T) {
+	t.Parallel()
+
+	nc := newNotificationCenter()
+	for i := range maxNotifications + 10 {
+		nc.add(notifyInfo, strconv.Itoa(i))
+	}
+
+	list := nc.list()
+	if len(list) != maxNotifications {
+		t.Fatalf("expected (%v) notifications, got (%v)", maxNotifications, len(list))
+	}
+
+	if list[0].Message != strconv.Itoa(maxNotifications+9) || list[len(list)-1].Message != "10" {
+		t.Fatalf("expected the oldest notifications to be dropped, got newest (%v) and oldest (%v)", list[0].Message, list[len(list)-1].Message)
+	}
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// offlineCacheMaxAge of listings kept in the offline cache, older ones are dropped when loading
+	offlineCacheMaxAge = 30 * 24 * time.Hour
+
+	// offlineCacheWriteBuffer is how many listings may wait to be written before new ones are dropped
+	offlineCacheWriteBuffer = 256
+
+	// offlineRetryInterval between tries to reach filebrowser again while offline
+	offlineRetryInterval = 15 * time.Second
+)
+
+// offlineNodesBucket holds a bucket per offlineScope, which holds the listings by path.
+var offlineNodesBucket = []byte("nodes")
+
+// offlineEntry is a listing in the offline cache.
+type offlineEntry struct {
+	Path     string    `json:"-"`
+	Resource *Resource `json:"resource"`
+
+	// Fetched is when filebrowser answered with Resource
+	Fetched time.Time `json:"fetched"`
+}
+
+// offlineWrite waiting to be written into the offline cache.
+type offlineWrite struct {
+	scope string
+	entry offlineEntry
+
+	// deleteTree of entry.Path, everything below it included, instead of putting entry
+	deleteTree bool
+}
+
+// offlineCache persists the directory listings of NodeCaches in a bbolt database,
+// so they can be shown right away on startup and while filebrowser can't be reached.
+type offlineCache struct {
+	db *bbolt.DB
+
+	// mu guards closed and sending on writes
+	mu     sync.RWMutex
+	closed bool
+	writes chan offlineWrite
+
+	// written is closed once every write was written
+	written chan struct{}
+}
+
+// offlineScope of the listings of user on host.
+func offlineScope(host, user string) string {
+	return host + "\x00" + user
+}
+
+func openOfflineCache(path string) (*offlineCache, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open offline cache (%v): %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(offlineNodesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create bucket in offline cache (%v): %w", path, err)
+	}
+
+	oc := &offlineCache{
+		db:      db,
+		writes:  make(chan offlineWrite, offlineCacheWriteBuffer),
+		written: make(chan struct{}),
+	}
+	go oc.write()
+
+	return oc, nil
+}
+
+// has is true if there is anything cached for scope.
+func (oc *offlineCache) has(scope string) bool {
+	has := false
+
+	err := oc.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(offlineNodesBucket).Bucket([]byte(scope))
+		has = b != nil && b.Stats().KeyN > 0
+		return nil
+	})
+	if err != nil {
+		slog.Error("could not read offline cache", "error", err)
+	}
+
+	return has
+}
+
+// load the listings of scope, oldest first, dropping the ones older than offlineCacheMaxAge or that can't be read.
+func (oc *offlineCache) load(scope string, now time.Time) ([]offlineEntry, error) {
+	var entries []offlineEntry
+
+	err := oc.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(offlineNodesBucket).Bucket([]byte(scope))
+		if b == nil {
+			return nil
+		}
+
+		var expired [][]byte
+
+		err := b.ForEach(func(k, v []byte) error {
+			entry := offlineEntry{Path: string(k)}
+			if err := json.Unmarshal(v, &entry); err != nil || entry.Resource == nil || now.Sub(entry.Fetched) > offlineCacheMaxAge {
+				expired = append(expired, slices.Clone(k))
+				return nil
+			}
+
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err = b.Delete(k); err != nil {
+				return fmt.Errorf("could not delete expired listing (%v): %w", string(k), err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load offline cache: %w", err)
+	}
+
+	slices.SortFunc(entries, func(a, b offlineEntry) int { return a.Fetched.Compare(b.Fetched) })
+
+	return entries, nil
+}
+
+// put the listing of p into scope in the background, dropping it if too many are waiting to be written.
+func (oc *offlineCache) put(scope, p string, res *Resource, fetched time.Time) {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+
+	if oc.closed {
+		return
+	}
+
+	select {
+	case oc.writes <- offlineWrite{scope: scope, entry: offlineEntry{Path: p, Resource: res, Fetched: fetched}}:
+	default:
+		slog.Debug("offline cache is busy, not persisting listing", "path", p)
+	}
+}
+
+// delete the listings of prefix and everything below it from scope in the background, for paths that are gone.
+// Unlike put it waits for room to write, a listing that's gone must not be restored again.
+func (oc *offlineCache) delete(scope, prefix string) {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+
+	if oc.closed {
+		return
+	}
+
+	oc.writes <- offlineWrite{scope: scope, entry: offlineEntry{Path: nodeKey(prefix)}, deleteTree: true}
+}
+
+// deleteTree of prefix from the listings in b.
+func deleteTree(b *bbolt.Bucket, prefix string) error {
+	var keys [][]byte
+
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		key := string(k)
+		if prefix == "/" || key == prefix || strings.HasPrefix(key, prefix+"/") {
+			keys = append(keys, slices.Clone(k))
+		}
+	}
+
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return fmt.Errorf("could not delete listing (%v): %w", string(k), err)
+		}
+	}
+
+	return nil
+}
+
+// write the listings sent to writes, as many at once as are waiting.
+func (oc *offlineCache) write() {
+	defer close(oc.written)
+
+	for w := range oc.writes {
+		batch := []offlineWrite{w}
+
+	drain:
+		for {
+			select {
+			case w, ok := <-oc.writes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, w)
+			default:
+				break drain
+			}
+		}
+
+		err := oc.db.Update(func(tx *bbolt.Tx) error {
+			for _, w := range batch {
+				if w.deleteTree {
+					if b := tx.Bucket(offlineNodesBucket).Bucket([]byte(w.scope)); b != nil {
+						if err := deleteTree(b, w.entry.Path); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+
+				b, err := tx.Bucket(offlineNodesBucket).CreateBucketIfNotExists([]byte(w.scope))
+				if err != nil {
+					return fmt.Errorf("could not create bucket of scope: %w", err)
+				}
+
+				bs, err := json.Marshal(w.entry)
+				if err != nil {
+					return fmt.Errorf("could not marshal listing of (%v): %w", w.entry.Path, err)
+				}
+
+				if err = b.Put([]byte(w.entry.Path), bs); err != nil {
+					return fmt.Errorf("could not put listing of (%v): %w", w.entry.Path, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("could not write offline cache", "error", err)
+		}
+	}
+}
+
+// Close the offline cache after writing every listing waiting to be.
+func (oc *offlineCache) Close() error {
+	oc.mu.Lock()
+	if !oc.closed {
+		oc.closed = true
+		close(oc.writes)
+	}
+	oc.mu.Unlock()
+
+	<-oc.written
+
+	if err := oc.db.Close(); err != nil {
+		return fmt.Errorf("could not close offline cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOfflineCache(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), offlineCacheFileName)
+
+	oc, err := openOfflineCache(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	scope, other := offlineScope("https://host", "alice"), offlineScope("https://host", "bob")
+
+	oc.put(scope, "/new", &Resource{Path: "/new", IsDir: true}, now)
+	oc.put(scope, "/old", &Resource{Path: "/old", IsDir: true}, now.Add(-time.Hour))
+	oc.put(scope, "/expired", &Resource{Path: "/expired", IsDir: true}, now.Add(-offlineCacheMaxAge-time.Hour))
+	oc.put(other, "/bob", &Resource{Path: "/bob", IsDir: true}, now)
+
+	if err = oc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a closed cache drops writes
+	oc.put(scope, "/closed", &Resource{Path: "/closed"}, now)
+
+	oc, err = openOfflineCache(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oc.Close()
+
+	if !oc.has(scope) || oc.has(offlineScope("https://other", "alice")) {
+		t.Fatal("expected only the scopes written to to have listings")
+	}
+
+	entries, err := oc.load(scope, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Path != "/old" || entries[1].Path != "/new" || entries[1].Resource.Path != "/new" {
+		t.Fatalf("expected /old and /new oldest first, got (%+v)", entries)
+	}
+
+	if !entries[1].Fetched.Equal(now) {
+		t.Fatalf("expected fetched time (%v), got (%v)", now, entries[1].Fetched)
+	}
+
+	if entries, err = oc.load(scope, now); err != nil || len(entries) != 2 {
+		t.Fatalf("expected the expired listing to stay deleted, got (%v) entries: %v", len(entries), err)
+	}
+}
+
+func TestOfflineCacheDelete(t *testing.T) {
+	t.Parallel()
+
+	oc, err := openOfflineCache(filepath.Join(t.TempDir(), offlineCacheFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oc.Close()
+
+	now := time.Now()
+	scope := offlineScope("https://host", "alice")
+
+	for _, p := range []string{"/a", "/a/b", "/a/b/c", "/ab", "/d"} {
+		oc.put(scope, p, &Resource{Path: p, IsDir: true}, now)
+	}
+	oc.delete(scope, "/a/")
+	oc.delete(scope, "/missing")
+
+	// deleting waits its turn after the puts before it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, err := oc.load(scope, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		slices.Sort(paths)
+
+		if slices.Equal(paths, []string{"/ab", "/d"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected only /ab and /d to stay, got (%v)", paths)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodeCacheRestore(t *testing.T) {
+	t.Parallel()
+
+	var online atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !online.Load() {
+			// like a proxy that can't reach filebrowser, the connection drops without an answer
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"path":"/d","name":"online","isDir":true}`)
+	}))
+	defer srv.Close()
+
+	oc, err := openOfflineCache(filepath.Join(t.TempDir(), offlineCacheFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oc.Close()
+
+	scope := offlineScope(srv.URL, "alice")
+	oc.put(scope, "/d", &Resource{Path: "/d", Name: "restored", IsDir: true}, time.Now().Add(-time.Hour))
+
+	// wait for the write
+	for deadline := time.Now().Add(5 * time.Second); !oc.has(scope); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the offline cache to be written")
+		}
+	}
+
+	nc := NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{})
+	if err = nc.Restore(oc, scope); err != nil {
+		t.Fatal(err)
+	}
+
+	revalidated := make(chan string, 4)
+	defer nc.OnRevalidated(func(p string) { revalidated <- p })()
+
+	waitRevalidated := func() {
+		t.Helper()
+		select {
+		case <-revalidated:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a revalidation")
+		}
+	}
+
+	if freshness, _ := nc.Freshness("/d"); freshness != nodeRestored {
+		t.Fatalf("expected a restored listing, got (%v)", freshness)
+	}
+
+	res, err := nc.Info(context.Background(), "/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Name != "restored" {
+		t.Fatalf("expected the restored listing right away, got (%v)", res.Name)
+	}
+
+	waitRevalidated()
+
+	if freshness, _ := nc.Freshness("/d"); freshness != nodeOffline || !nc.Offline() {
+		t.Fatalf("expected an offline listing and cache while filebrowser can't be reached, got (%v, %v)", freshness, nc.Offline())
+	}
+
+	online.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// only pinned listings are revalidated in the background
+	nc.Pin("/d")
+	go nc.RevalidateEvery(ctx, time.Millisecond)
+
+	waitRevalidated()
+
+	if freshness, _ := nc.Freshness("/d"); freshness != nodeFresh || nc.Offline() {
+		t.Fatalf("expected a fresh listing once filebrowser can be reached, got (%v, %v)", freshness, nc.Offline())
+	}
+
+	if res, _ = nc.Info(context.Background(), "/d"); res.Name != "online" {
+		t.Fatalf("expected the revalidated listing, got (%v)", res.Name)
+	}
+}
+
+func TestIsConnectivityError(t *testing.T) {
+	t.Parallel()
+
+	sess := &filebrowserSession{host: "http://127.0.0.1:1"}
+
+	_, err := sess.Info(context.Background(), "/")
+	if !isConnectivityError(err) {
+		t.Fatalf("expected (%v) to be a connectivity error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = sess.Info(ctx, "/"); isConnectivityError(err) {
+		t.Fatalf("expected (%v) to not be a connectivity error", err)
+	}
+
+	if isConnectivityError(fmt.Errorf("non-200 http status while getting info: %w", errors.New("401 Unauthorized"))) {
+		t.Fatal("expected an error answer to not be a connectivity error")
+	}
+}
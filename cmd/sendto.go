@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// sendToName is the name of the file manager action.
+const sendToName = "Send to filebrowser"
+
+// desktopExecQuote arg for the Exec key of a desktop entry.
+func desktopExecQuote(arg string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, r := range arg {
+		switch r {
+		case '"', '`', '$', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+
+	// the desktop entry format escapes backslashes a second time inside of string values
+	return strings.ReplaceAll(b.String(), `\`, `\\`)
+}
+
+// sendToAction is the file that adds the "Send to filebrowser" action to the file manager of goos,
+// running exe with args followed by the selected paths.
+func sendToAction(goos string, exe string, args []string) (path string, content []byte, err error) {
+	switch goos {
+	case "windows":
+		// the SendTo folder of explorer runs anything in it with the selected paths as arguments
+		appData := os.Getenv("APPDATA")
+		if appData == "" {
+			return "", nil, errors.New("APPDATA is not set, could not find the SendTo folder")
+		}
+
+		cmdline := []string{`"` + exe + `"`}
+		for _, arg := range args {
+			cmdline = append(cmdline, `"`+arg+`"`)
+		}
+
+		return filepath.Join(appData, "Microsoft", "Windows", "SendTo", sendToName+".cmd"),
+			[]byte("@start \"\" " + strings.Join(cmdline, " ") + " %*\r\n"), nil
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		// file managers following the freedesktop specifications list the desktop entry under "Open With"
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", nil, fmt.Errorf("could not find the home directory: %w", err)
+			}
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+
+		exec := []string{desktopExecQuote(exe)}
+		for _, arg := range args {
+			exec = append(exec, desktopExecQuote(arg))
+		}
+
+		return filepath.Join(dataHome, "applications", "filebrowserui-send-to.desktop"), []byte(
+			"[Desktop Entry]\n" +
+				"Type=Application\n" +
+				"Name=" + sendToName + "\n" +
+				"Exec=" + strings.Join(exec, " ") + " %F\n" +
+				"MimeType=application/octet-stream;inode/directory;\n" +
+				"NoDisplay=true\n" +
+				"Terminal=false\n",
+		), nil
+	default:
+		return "", nil, fmt.Errorf("installing the %q action is not supported on (%v)", sendToName, goos)
+	}
+}
+
+// RunInstallSendTo is the "install-send-to" command, adding (or removing) a "Send to filebrowser" action to the file manager
+// that starts filebrowserui with the selected paths, handing them to the running instance if there is one.
+func RunInstallSendTo(args []string) error {
+	flags := flag.NewFlagSet("install-send-to", flag.ContinueOnError)
+	uninstall := flags.Bool("uninstall", false, "remove the action instead of installing it")
+	configDir := flags.String("configDir", "", "configuration directory passed to filebrowserui by the action, defaults to the default configuration directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the path of filebrowserui: %w", err)
+	}
+
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return fmt.Errorf("could not resolve the path of filebrowserui: %w", err)
+	}
+
+	var exeArgs []string
+	if *configDir != "" {
+		abs, err := filepath.Abs(*configDir)
+		if err != nil {
+			return fmt.Errorf("could not get absolute path of (%v): %w", *configDir, err)
+		}
+		exeArgs = append(exeArgs, "-configDir="+abs)
+	}
+
+	actionPath, content, err := sendToAction(runtime.GOOS, exe, exeArgs)
+	if err != nil {
+		return err
+	}
+
+	if *uninstall {
+		if err := os.Remove(actionPath); err != nil {
+			return fmt.Errorf("could not remove (%v): %w", actionPath, err)
+		}
+
+		fmt.Printf("removed %v\n", actionPath)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(actionPath), 0750); err != nil {
+		return fmt.Errorf("could not create directory for (%v): %w", actionPath, err)
+	}
+
+	// #nosec G306 -- the file manager must be able to read and run the action
+	if err := os.WriteFile(actionPath, content, 0700); err != nil {
+		return fmt.Errorf("could not write (%v): %w", actionPath, err)
+	}
+
+	fmt.Printf("installed %v\n", actionPath)
+	return nil
+}
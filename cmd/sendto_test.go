@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDesktopExecQuote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"/usr/bin/filebrowserui", `"/usr/bin/filebrowserui"`},
+		{"/opt/my apps/filebrowserui", `"/opt/my apps/filebrowserui"`},
+		{`/tmp/$HOME"x`, `"/tmp/\\$HOME\\"x"`},
+		{`/tmp/back\slash`, `"/tmp/back\\\\slash"`},
+	}
+
+	for _, test := range tests {
+		if got := desktopExecQuote(test.arg); got != test.want {
+			t.Fatalf("desktopExecQuote(%q) = %q, expected %q", test.arg, got, test.want)
+		}
+	}
+}
+
+func TestSendToAction(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	t.Setenv("APPDATA", `C:\Users\alice\AppData\Roaming`)
+
+	p, content, err := sendToAction("linux", "/usr/bin/filebrowserui", []string{"-configDir=/cfg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p != "/data/applications/filebrowserui-send-to.desktop" {
+		t.Fatalf("unexpected desktop entry path (%v)", p)
+	}
+
+	if !strings.Contains(string(content), "Exec=\"/usr/bin/filebrowserui\" \"-configDir=/cfg\" %F\n") {
+		t.Fatalf("unexpected desktop entry:\n%s", content)
+	}
+
+	_, content, err = sendToAction("windows", `C:\filebrowserui.exe`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "@start \"\" \"C:\\filebrowserui.exe\" %*\r\n" {
+		t.Fatalf("unexpected SendTo script %q", content)
+	}
+
+	if _, _, err := sendToAction("plan9", "/bin/filebrowserui", nil); err == nil {
+		t.Fatal("expected an error for an unsupported operating system")
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,31 +12,179 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type filebrowserSession struct {
-	host  string
-	token string
+	host string
+
+	// token is replaced when an offline session logs in, so it and its user are guarded by tokenMu
+	tokenMu sync.RWMutex
+	token   string
+
+	// user decoded from the claims of token, nil if they aren't known
+	user *User
+
+	// tokenChanged are called after setToken replaced token
+	tokenChanged []func()
+}
+
+// User of a filebrowser session, as filebrowser put them into the claims of the login token.
+type User struct {
+	ID           int      `json:"id"`
+	Username     string   `json:"username"`
+	Locale       string   `json:"locale"`
+	ViewMode     string   `json:"viewMode"`
+	SingleClick  bool     `json:"singleClick"`
+	HideDotfiles bool     `json:"hideDotfiles"`
+	DateFormat   bool     `json:"dateFormat"`
+	LockPassword bool     `json:"lockPassword"`
+	Commands     []string `json:"commands"`
+	Perm         UserPerm `json:"perm"`
+}
+
+// UserPerm are the permissions of a filebrowser user.
+type UserPerm struct {
+	Admin    bool `json:"admin"`
+	Execute  bool `json:"execute"`
+	Create   bool `json:"create"`
+	Rename   bool `json:"rename"`
+	Modify   bool `json:"modify"`
+	Delete   bool `json:"delete"`
+	Share    bool `json:"share"`
+	Download bool `json:"download"`
+}
+
+// has is true if perm is granted.
+func (p UserPerm) has(perm permission) bool {
+	switch perm {
+	case permCreate:
+		return p.Create
+	case permRename:
+		return p.Rename
+	case permModify:
+		return p.Modify
+	case permDelete:
+		return p.Delete
+	case permShare:
+		return p.Share
+	case permDownload:
+		return p.Download
+	}
+	return false
+}
+
+// parseTokenUser decodes the user from the claims of the JWT token filebrowser answers a login with.
+// The signature isn't checked, the token came from filebrowser and it checks it on every request.
+func parseTokenUser(token string) (*User, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token has (%v) parts instead of 3", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode claims of token: %w", err)
+	}
+
+	claims := struct {
+		User *User `json:"user"`
+	}{}
+
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("could not unmarshal claims of token: %w", err)
+	}
+
+	if claims.User == nil {
+		return nil, errors.New("token has no user claim")
+	}
+
+	return claims.User, nil
+}
+
+func (sess *filebrowserSession) authToken() string {
+	sess.tokenMu.RLock()
+	defer sess.tokenMu.RUnlock()
+
+	return sess.token
+}
+
+// setToken of sess and its user, who isn't known if the token can't be decoded.
+func (sess *filebrowserSession) setToken(token string) {
+	user, err := parseTokenUser(token)
+	if err != nil {
+		slog.Warn("could not read user from login token, offering every action", "error", err)
+	}
+
+	sess.tokenMu.Lock()
+	sess.token, sess.user = token, user
+	listeners := slices.Clone(sess.tokenChanged)
+	sess.tokenMu.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+// OnTokenChanged calls f after the token and user of sess were replaced, on the goroutine that replaced them.
+func (sess *filebrowserSession) OnTokenChanged(f func()) {
+	sess.tokenMu.Lock()
+	defer sess.tokenMu.Unlock()
+
+	sess.tokenChanged = append(sess.tokenChanged, f)
+}
+
+// User of sess, nil if they aren't known.
+func (sess *filebrowserSession) User() *User {
+	sess.tokenMu.RLock()
+	defer sess.tokenMu.RUnlock()
+
+	return sess.user
+}
+
+// permission of a filebrowser user to change or get their files.
+type permission string
+
+const (
+	permCreate   permission = "create"
+	permRename   permission = "rename"
+	permModify   permission = "modify"
+	permDelete   permission = "delete"
+	permShare    permission = "share"
+	permDownload permission = "download"
+)
+
+// can is true if the user of sess has perm.
+// If their permissions aren't known it's true, and filebrowser refuses what they lack.
+func (sess *filebrowserSession) can(perm permission) bool {
+	user := sess.User()
+	if user == nil {
+		return true
+	}
+	return user.Perm.has(perm)
+}
+
+// isConnectivityError is true if err is from filebrowser not being reachable, rather than it refusing a request.
+func isConnectivityError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var urlErr *url.Error
+	var resumable ErrResumable
+	return errors.As(err, &urlErr) || errors.As(err, &resumable)
 }
 
 type Resource struct {
 	// These fields exist only for Directories
 	// TODO: maybe make these fields pointers, or move them to another struct
-	Items []struct {
-		Path      string    `json:"path"`
-		Name      string    `json:"name"`
-		Size      int       `json:"size"`
-		Extension string    `json:"extension"`
-		Modified  time.Time `json:"modified"`
-		Mode      int64     `json:"mode"`
-		IsDir     bool      `json:"isDir"`
-		IsSymlink bool      `json:"isSymlink"`
-		Type      string    `json:"type"`
-	} `json:"items"`
-	NumDirs  int `json:"numDirs"`
-	NumFiles int `json:"numFiles"`
+	Items    []ResourceItem `json:"items"`
+	NumDirs  int            `json:"numDirs"`
+	NumFiles int            `json:"numFiles"`
 	Sorting  struct {
 		By  string `json:"by"`
 		Asc bool   `json:"asc"`
@@ -53,6 +202,25 @@ type Resource struct {
 	Type      string    `json:"type"`
 }
 
+// ResourceItem is an entry of the listing of a directory Resource.
+type ResourceItem struct {
+	Path      string    `json:"path"`
+	Name      string    `json:"name"`
+	Size      int       `json:"size"`
+	Extension string    `json:"extension"`
+	Modified  time.Time `json:"modified"`
+	Mode      int64     `json:"mode"`
+	IsDir     bool      `json:"isDir"`
+	IsSymlink bool      `json:"isSymlink"`
+	Type      string    `json:"type"`
+}
+
+// ErrResourceNotFound is returned when the server has nothing at the requested path.
+var ErrResourceNotFound = errors.New("filebrowserui-session: resource not found")
+
+// ErrPermissionDenied is returned when the user lacks a permission for what they tried.
+var ErrPermissionDenied = errors.New("filebrowserui-session: permission denied")
+
 func (sess *filebrowserSession) Info(ctx context.Context, filepath string) (*Resource, error) {
 	slog.Debug("grabbing filebrowser resource", "path", filepath)
 
@@ -70,8 +238,8 @@ func (sess *filebrowserSession) Info(ctx context.Context, filepath string) (*Res
 		return nil, fmt.Errorf("could not create a http.GET(%v) : %w", uri.String(), err)
 	}
 
-	req.Header.Add("X-Auth", sess.token)
-	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.token})
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -79,6 +247,10 @@ func (sess *filebrowserSession) Info(ctx context.Context, filepath string) (*Res
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("(%v): %w", filepath, ErrResourceNotFound)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("non-200 http status while getting info: %v", resp.Status)
 	}
@@ -124,8 +296,8 @@ func (sess *filebrowserSession) SHA256(ctx context.Context, filepath string) (st
 		return "", fmt.Errorf("could not create a http.GET( %v ): %w", uri.String(), err)
 	}
 
-	req.Header.Add("X-Auth", sess.token)
-	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.token})
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -222,8 +394,8 @@ func (sess *filebrowserSession) createTUSFile(ctx context.Context, filepath stri
 		return fmt.Errorf("could not create a http.POST (%v): %w", uri.String(), err)
 	}
 
-	req.Header.Add("X-Auth", sess.token)
-	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.token})
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
 
 	resp, err := (&http.Client{Timeout: time.Second * 5}).Do(req)
 	if err != nil {
@@ -262,8 +434,8 @@ func (sess *filebrowserSession) headTUSFile(ctx context.Context, filepath string
 		return 0, fmt.Errorf("could not http.HEAD (%v): %w", uri.String(), err)
 	}
 
-	req.Header.Add("X-Auth", sess.token)
-	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.token})
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
 
 	// Show that we understand the tus protocol
 	req.Header.Add("Tus-Resumable", "1.0.0")
@@ -313,8 +485,8 @@ func (sess *filebrowserSession) uploadTUSReader(ctx context.Context, filepath st
 		return fmt.Errorf("could not http.PATCH (%v): %w", uri.String(), err)
 	}
 
-	req.Header.Add("X-Auth", sess.token)
-	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.token})
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
 
 	// Show that we understand the tus protocol
 	req.Header.Add("Tus-Resumable", "1.0.0")
@@ -394,8 +566,236 @@ func (sess *filebrowserSession) uploadReader(ctx context.Context, dir string, fi
 	return nil
 }
 
-// TODO: add ability to create a directory
-// TODO: add ability to download files
+// CreateDirectory dir on the server, succeeding if it already exists.
+// filebrowser creates a directory instead of a file when the resource path ends with a slash.
+func (sess *filebrowserSession) CreateDirectory(ctx context.Context, dir string) error {
+	slog.Debug("creating directory on filebrowser", "path", dir)
+
+	uri, err := url.Parse(sess.host)
+	if err != nil {
+		return fmt.Errorf("(%v) is not a valid url: %w", sess.host, err)
+	}
+
+	uri = uri.JoinPath("/api/resources/", path.Clean(dir))
+	uri.Path += "/"
+
+	query := uri.Query()
+	query.Add("override", "false")
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uri.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create a http.POST (%v): %w", uri.String(), err)
+	}
+
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
+
+	resp, err := (&http.Client{Timeout: time.Second * 5}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to http.POST (%v): %w", uri.String(), err)
+	}
+	defer resp.Body.Close()
+
+	// filebrowser answers 409 when something already exists at the path
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return fmt.Errorf("non-200 http status code while creating directory (%v): %v", uri.String(), resp.Status)
+	}
+
+	return nil
+}
+
+// Move src to dst on the server, failing if something already is at dst.
+func (sess *filebrowserSession) Move(ctx context.Context, src, dst string) error {
+	return sess.patchResource(ctx, "rename", src, dst)
+}
+
+// Copy src to dst on the server, failing if something already is at dst.
+func (sess *filebrowserSession) Copy(ctx context.Context, src, dst string) error {
+	return sess.patchResource(ctx, "copy", src, dst)
+}
+
+// patchResource src with action, "rename" or "copy", to dst.
+func (sess *filebrowserSession) patchResource(ctx context.Context, action, src, dst string) error {
+	slog.Debug("patching filebrowser resource", "action", action, "src", src, "dst", dst)
+
+	uri, err := url.Parse(sess.host)
+	if err != nil {
+		return fmt.Errorf("(%v) is not a valid url: %w", sess.host, err)
+	}
+
+	uri = uri.JoinPath("/api/resources/", path.Clean(src))
+
+	// filebrowser unescapes the destination once more after the query was parsed
+	query := uri.Query()
+	query.Add("action", action)
+	query.Add("destination", url.QueryEscape(path.Clean(dst)))
+	query.Add("override", "false")
+	query.Add("rename", "false")
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", uri.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create a http.PATCH (%v): %w", uri.String(), err)
+	}
+
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
+
+	resp, err := (&http.Client{Timeout: time.Second * 30}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to http.PATCH (%v): %w", uri.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("could not %v (%v), (%v) already exists", action, src, dst)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-200 http status code while trying to %v (%v): %v", action, src, resp.Status)
+	}
+
+	return nil
+}
+
+// Delete p on the server, with everything in it if it's a directory.
+func (sess *filebrowserSession) Delete(ctx context.Context, p string) error {
+	slog.Debug("deleting filebrowser resource", "path", p)
+
+	uri, err := url.Parse(sess.host)
+	if err != nil {
+		return fmt.Errorf("(%v) is not a valid url: %w", sess.host, err)
+	}
+
+	uri = uri.JoinPath("/api/resources/", path.Clean(p))
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", uri.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not create a http.DELETE (%v): %w", uri.String(), err)
+	}
+
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
+
+	resp, err := (&http.Client{Timeout: time.Second * 30}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to http.DELETE (%v): %w", uri.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("non-200 http status code while deleting (%v): %v", p, resp.Status)
+	}
+
+	return nil
+}
+
+// Share p with a link that doesn't expire, returning the link.
+func (sess *filebrowserSession) Share(ctx context.Context, p string) (string, error) {
+	slog.Debug("sharing filebrowser resource", "path", p)
+
+	uri, err := url.Parse(sess.host)
+	if err != nil {
+		return "", fmt.Errorf("(%v) is not a valid url: %w", sess.host, err)
+	}
+
+	shareURI := uri.JoinPath("/api/share/", path.Clean(p))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", shareURI.String(), bytes.NewReader([]byte(`{"password":"","expires":"","unit":"hours"}`)))
+	if err != nil {
+		return "", fmt.Errorf("could not create a http.POST (%v): %w", shareURI.String(), err)
+	}
+
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
+
+	resp, err := (&http.Client{Timeout: time.Second * 5}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to http.POST (%v): %w", shareURI.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("non-200 http status code while sharing (%v): %v", p, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1e5))
+	if err != nil {
+		return "", fmt.Errorf("could not read resp body: %w", err)
+	}
+
+	link := struct {
+		Hash string `json:"hash"`
+	}{}
+
+	if err := json.Unmarshal(body, &link); err != nil {
+		return "", fmt.Errorf("could not decode json from filebrowser (%v): %w", sess.host, err)
+	}
+
+	if link.Hash == "" {
+		return "", fmt.Errorf("filebrowser answered without a share link for (%v)", p)
+	}
+
+	return uri.JoinPath("/share/", link.Hash).String(), nil
+}
+
+// rawURL downloading p, directories as a zip archive.
+// The url needs the auth cookie of a logged in browser, it doesn't include the token.
+func (sess *filebrowserSession) rawURL(p string, isDir bool) (string, error) {
+	uri, err := url.Parse(sess.host)
+	if err != nil {
+		return "", fmt.Errorf("(%v) is not a valid url: %w", sess.host, err)
+	}
+
+	uri = uri.JoinPath("/api/raw/", path.Clean(p))
+
+	if isDir {
+		query := uri.Query()
+		query.Add("algo", "zip")
+		uri.RawQuery = query.Encode()
+	}
+
+	return uri.String(), nil
+}
+
+// Download p into w, directories as a zip archive.
+func (sess *filebrowserSession) Download(ctx context.Context, p string, isDir bool, w io.Writer) error {
+	slog.Debug("downloading filebrowser resource", "path", p)
+
+	raw, err := sess.rawURL(p, isDir)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", raw, nil)
+	if err != nil {
+		return fmt.Errorf("could not create a http.GET (%v): %w", raw, err)
+	}
+
+	req.Header.Add("X-Auth", sess.authToken())
+	req.AddCookie(&http.Cookie{Name: "auth", Value: sess.authToken()})
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not http.Do request (GET %v): %w", raw, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("(%v): %w", p, ErrResourceNotFound)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("non-200 http status code while downloading (%v): %v", p, resp.Status)
+	}
+
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("could not download (%v): %w", p, err)
+	}
+
+	return nil
+}
 
 func loginToFilebrowser(host, user, pass string) (sess *filebrowserSession, err error) {
 	slog.Debug("logging into filebrowser", "host", host, "user", user)
@@ -440,7 +840,7 @@ func loginToFilebrowser(host, user, pass string) (sess *filebrowserSession, err
 		return nil, fmt.Errorf("could not read body from login request: %w", err)
 	}
 
-	sess.token = string(body)
+	sess.setToken(string(body))
 
 	return sess, nil
 }
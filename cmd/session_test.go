@@ -4,8 +4,15 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -61,3 +68,136 @@ func TestUpload(t *testing.T) {
 
 // TODO: this is implicitly tested by TestUpload, but it should be tested on its own
 func TestSHA256(t *testing.T) {}
+
+func TestSessionActions(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var requests []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.Method == "PATCH":
+			// filebrowser unescapes the destination once more
+			dst, err := url.QueryUnescape(r.URL.Query().Get("destination"))
+			if err != nil || dst != "/b/50% off+more.txt" || r.URL.Query().Get("override") != "false" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("action") == "copy" {
+				w.WriteHeader(http.StatusConflict)
+			}
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/share/"):
+			_, _ = io.WriteString(w, `{"hash":"abc","path":"/a.txt"}`)
+		case r.Method == "GET" && r.URL.Path == "/api/raw/d":
+			_, _ = io.WriteString(w, r.URL.Query().Get("algo"))
+		}
+	}))
+	defer srv.Close()
+
+	sess := &filebrowserSession{host: srv.URL, token: "token"}
+	ctx := context.Background()
+
+	if err := sess.Move(ctx, "/a.txt", "/b/50% off+more.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sess.Copy(ctx, "/a.txt", "/b/50% off+more.txt"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected copying onto an existing file to fail, got (%v)", err)
+	}
+
+	if err := sess.Delete(ctx, "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := sess.Share(ctx, "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != srv.URL+"/share/abc" {
+		t.Fatalf("expected share link (%v/share/abc), got (%v)", srv.URL, link)
+	}
+
+	var buf bytes.Buffer
+	if err = sess.Download(ctx, "/d", true, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "zip" {
+		t.Fatalf("expected directory to be downloaded as a zip, got (%v)", buf.String())
+	}
+
+	want := []string{"PATCH /api/resources/a.txt", "PATCH /api/resources/a.txt", "DELETE /api/resources/a.txt", "POST /api/share/a.txt", "GET /api/raw/d"}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected requests (%v), got (%v)", want, requests)
+	}
+}
+
+// testToken signed by nobody, with the claims filebrowser puts into login tokens.
+func testToken(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestParseTokenUser(t *testing.T) {
+	t.Parallel()
+
+	user, err := parseTokenUser(testToken(`{"user":{"id":3,"username":"bob","locale":"en","hideDotfiles":true,` +
+		`"perm":{"admin":false,"create":true,"rename":false,"modify":true,"delete":false,"share":true,"download":true}},"exp":1700000000}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != 3 || user.Username != "bob" || !user.HideDotfiles {
+		t.Fatalf("expected the user bob with settings, got (%+v)", user)
+	}
+
+	want := map[permission]bool{permCreate: true, permRename: false, permModify: true, permDelete: false, permShare: true, permDownload: true}
+	for perm, granted := range want {
+		if user.Perm.has(perm) != granted {
+			t.Errorf("expected permission (%v) to be (%v)", perm, granted)
+		}
+	}
+
+	for _, token := range []string{"", "not a token", testToken(`{"exp":1}`), "a.!!!.c"} {
+		if _, err := parseTokenUser(token); err == nil {
+			t.Errorf("expected (%v) to not have a user", token)
+		}
+	}
+}
+
+func TestSessionCan(t *testing.T) {
+	t.Parallel()
+
+	sess := &filebrowserSession{}
+
+	sess.setToken("opaque")
+	if sess.User() != nil || !sess.can(permDelete) {
+		t.Fatal("expected a user that isn't known to be offered every action")
+	}
+
+	changed := 0
+	sess.OnTokenChanged(func() {
+		changed++
+		if sess.can(permDelete) {
+			t.Error("expected listeners to see the new token")
+		}
+	})
+
+	sess.setToken(testToken(`{"user":{"perm":{"download":true}}}`))
+	if sess.can(permDelete) || !sess.can(permDownload) {
+		t.Fatal("expected the permissions of the token")
+	}
+
+	if changed != 1 {
+		t.Fatalf("expected 1 token change, got (%v)", changed)
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// quitNowTimeout is how long "Quit now" waits for cancelled uploads to record their state in the WAL.
+const quitNowTimeout = 2 * time.Second
+
+// shutdownMode is how uploads in progress are handled when quitting.
+type shutdownMode uint8
+
+const (
+	// shutdownFinishCurrent lets the files being uploaded finish, without starting any others.
+	shutdownFinishCurrent shutdownMode = iota
+	// shutdownPause cancels the files being uploaded and records how far they got, they resume on the next run.
+	shutdownPause
+	// shutdownNow cancels the files being uploaded, only waiting quitNowTimeout for them to record their state.
+	shutdownNow
+)
+
+// stopUploads of the application according to mode, ctx cancels shutdownFinishCurrent early.
+// Anything set on the appState afterwards is closed right away.
+func (s *appState) stopUploads(ctx context.Context, mode shutdownMode) error {
+	s.mu.Lock()
+	uploads := s.uploads
+	s.uploads = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	if uploads == nil {
+		return nil
+	}
+
+	switch mode {
+	case shutdownFinishCurrent:
+		return uploads.Drain(ctx)
+	case shutdownNow:
+		return uploads.StopWithin(quitNowTimeout)
+	default:
+		return uploads.Stop()
+	}
+}
+
+// activeUploads of the application, nil if the upload manager isn't running.
+func (s *appState) activeUploads() []string {
+	s.mu.Lock()
+	uploads := s.uploads
+	s.mu.Unlock()
+
+	if uploads == nil {
+		return nil
+	}
+
+	active := uploads.Active()
+
+	lines := make([]string, 0, len(active))
+	for i := range active {
+		lines = append(lines, fmt.Sprintf("%v → %v (%v)",
+			strings.ReplaceAll(active[i].Item.LocalPath, "\n", "\\n"),
+			strings.ReplaceAll(active[i].Item.RemotePath, "\n", "\\n"),
+			formatBytes(active[i].Item.Size),
+		))
+	}
+
+	return lines
+}
+
+// quitter asks the user how to handle uploads in progress before the application quits.
+type quitter struct {
+	a     fyne.App
+	w     fyne.Window
+	state *appState
+
+	// asking is true while the prompt is shown, so closing the window twice doesn't stack prompts
+	asking bool
+
+	// quitting is true once a choice was made
+	quitting bool
+}
+
+// request to quit, quitting right away if nothing is being uploaded. Must be called on the fyne goroutine.
+func (q *quitter) request() {
+	if q.asking {
+		return
+	}
+
+	active := q.state.activeUploads()
+	if len(active) == 0 {
+		q.quit(shutdownPause)
+		return
+	}
+
+	q.asking = true
+
+	var modal *widget.PopUp
+
+	choose := func(mode shutdownMode) func() {
+		return func() {
+			modal.Hide()
+			q.quit(mode)
+		}
+	}
+
+	list := widget.NewMultiLineEntry()
+	list.SetText(strings.Join(active, "\n"))
+	list.OnChanged = func(_ string) {
+		list.SetText(strings.Join(active, "\n"))
+	}
+
+	buttons := container.NewHBox(
+		widget.NewButton("Finish current files", choose(shutdownFinishCurrent)),
+		widget.NewButton("Pause and quit", choose(shutdownPause)),
+		widget.NewButton("Quit now", choose(shutdownNow)),
+		widget.NewButton("Keep running", func() {
+			modal.Hide()
+			q.asking = false
+		}),
+	)
+
+	content := container.New(&priorityVLayout{},
+		list,
+		container.NewVBox(
+			widget.NewLabel(fmt.Sprintf("%v files are still being uploaded, unfinished uploads resume the next time filebrowserui starts.", len(active))),
+			container.NewCenter(buttons),
+		),
+	)
+
+	modal = widget.NewModalPopUp(content, q.w.Canvas())
+	modal.Show()
+	modal.Resize(fyne.NewSize(q.w.Canvas().Size().Width, q.w.Canvas().Size().Height/2))
+}
+
+// quit the application after stopping the uploads according to mode. Must be called on the fyne goroutine.
+func (q *quitter) quit(mode shutdownMode) {
+	if q.quitting {
+		return
+	}
+	q.quitting = true
+
+	ctx, quitNow := context.WithCancel(context.Background())
+
+	if mode == shutdownFinishCurrent {
+		var modal *widget.PopUp
+		modal = widget.NewModalPopUp(
+			container.NewVBox(
+				widget.NewLabel("Finishing the files being uploaded…"),
+				container.NewCenter(widget.NewButton("Quit now", func() {
+					modal.Hide()
+					quitNow()
+				})),
+			),
+			q.w.Canvas(),
+		)
+		modal.Show()
+	}
+
+	go func() {
+		defer quitNow()
+
+		if err := q.state.stopUploads(ctx, mode); err != nil {
+			slog.Error("could not stop uploads cleanly", "error", err)
+		}
+
+		fyne.Do(q.a.Quit)
+	}()
+}
+
+// interceptQuit of w and of SIGINT/SIGTERM, asking the user what to do with uploads in progress.
+// A second signal while asking quits right away.
+func interceptQuit(a fyne.App, w fyne.Window, state *appState) {
+	q := &quitter{a: a, w: w, state: state}
+
+	w.SetCloseIntercept(q.request)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		asked := false
+		for sig := range signals {
+			slog.Info("received signal", "signal", sig.String())
+
+			if asked {
+				fyne.Do(func() { q.quit(shutdownNow) })
+				return
+			}
+			asked = true
+
+			fyne.Do(q.request)
+		}
+	}()
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ctII/filebrowserui/wal"
+)
+
+// transferState of a row in the transfers panel.
+type transferState uint8
+
+const (
+	transferActive transferState = iota
+	transferQueued
+	transferPaused
+	transferFailed
+	transferCompleted
+)
+
+var transferStateNames = [...]string{
+	transferActive:    "active",
+	transferQueued:    "queued",
+	transferPaused:    "paused",
+	transferFailed:    "failed",
+	transferCompleted: "completed",
+}
+
+func (s transferState) String() string {
+	if int(s) < len(transferStateNames) {
+		return transferStateNames[s]
+	}
+	return fmt.Sprintf("transferState(%d)", s)
+}
+
+// transferStateOf an item recorded in the WAL.
+func transferStateOf(state wal.ItemState) transferState {
+	switch state {
+	case wal.StateUploading:
+		return transferActive
+	case wal.StatePaused:
+		return transferPaused
+	case wal.StateFailed:
+		return transferFailed
+	default:
+		return transferQueued
+	}
+}
+
+// rateSmoothing is the weight of the newest sample in the moving average of a transfer rate.
+const rateSmoothing = 0.3
+
+// transferRow is one file of the transfers panel.
+type transferRow struct {
+	localPath  string
+	remotePath string
+	size       int64
+	state      transferState
+	lastError  string
+
+	// sent bytes of the file, and the rate they are being sent at in bytes per second
+	sent int64
+	rate float64
+}
+
+// eta of the row, 0 if it is not known.
+func (r *transferRow) eta() time.Duration {
+	if r.state != transferActive || r.rate <= 0 || r.sent >= r.size {
+		return 0
+	}
+	return time.Duration(float64(r.size-r.sent) / r.rate * float64(time.Second))
+}
+
+// progress of the row from 0 to 1.
+func (r *transferRow) progress() float64 {
+	if r.state == transferCompleted || r.size <= 0 {
+		return 1
+	}
+	return min(float64(r.sent)/float64(r.size), 1)
+}
+
+// transferBatch is the rows of a batch in the transfers panel.
+type transferBatch struct {
+	id          string
+	destination string
+
+	rows  map[string]*transferRow
+	order []string
+}
+
+// counts of rows in every state, in the order of transferStateNames.
+func (b *transferBatch) counts() [len(transferStateNames)]int {
+	var counts [len(transferStateNames)]int
+	for _, row := range b.rows {
+		counts[row.state]++
+	}
+	return counts
+}
+
+// summary of the batch for its branch in the panel.
+func (b *transferBatch) summary() string {
+	counts := b.counts()
+
+	parts := make([]string, 0, len(counts))
+	for state, n := range counts {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%v %v", n, transferState(state)))
+		}
+	}
+
+	return fmt.Sprintf("%v: %v", strings.ReplaceAll(b.destination, "\n", "\\n"), strings.Join(parts, ", "))
+}
+
+// transfersModel is the state of the transfers panel, built from WAL events and the active uploads of the uploadManager.
+// It is not safe for concurrent use.
+type transfersModel struct {
+	batches map[string]*transferBatch
+	order   []string
+}
+
+func newTransfersModel() *transfersModel {
+	return &transfersModel{batches: make(map[string]*transferBatch)}
+}
+
+// addBatch to the model if it isn't there yet.
+func (m *transfersModel) addBatch(id string, destination string) *transferBatch {
+	if b, ok := m.batches[id]; ok {
+		if destination != "" {
+			b.destination = destination
+		}
+		return b
+	}
+
+	b := &transferBatch{id: id, destination: destination, rows: make(map[string]*transferRow)}
+	m.batches[id] = b
+	m.order = append(m.order, id)
+
+	return b
+}
+
+// setItem of batch id from its WAL record.
+func (m *transfersModel) setItem(id string, item wal.Item) {
+	b := m.addBatch(id, "")
+
+	row, ok := b.rows[item.LocalPath]
+	if !ok {
+		row = &transferRow{localPath: item.LocalPath}
+		b.rows[item.LocalPath] = row
+		b.order = append(b.order, item.LocalPath)
+	}
+
+	row.remotePath = item.RemotePath
+	row.size = item.Size
+	row.state = transferStateOf(item.State)
+	row.lastError = item.LastError
+	if row.state != transferActive {
+		row.sent = item.BytesConfirmed
+		row.rate = 0
+	}
+}
+
+// apply a WAL event to the model. destination is the destination of the batch of BatchCreated events.
+func (m *transfersModel) apply(ev wal.Event, destination string) {
+	switch ev.Type {
+	case wal.BatchCreated:
+		m.addBatch(ev.BatchID, destination)
+	case wal.ItemStarted, wal.ItemUpdated, wal.ItemFailed:
+		m.setItem(ev.BatchID, ev.Item)
+	case wal.ItemFinished:
+		m.setItem(ev.BatchID, ev.Item)
+
+		row := m.batches[ev.BatchID].rows[ev.Item.LocalPath]
+		row.state = transferCompleted
+		row.sent = row.size
+		row.rate = 0
+	case wal.ItemRemoved:
+		b, ok := m.batches[ev.BatchID]
+		if !ok {
+			return
+		}
+
+		delete(b.rows, ev.Item.LocalPath)
+		b.order = slices.DeleteFunc(b.order, func(p string) bool { return p == ev.Item.LocalPath })
+	case wal.BatchRemoved:
+		// completed rows stay until the panel is closed, everything else left with the batch
+		b, ok := m.batches[ev.BatchID]
+		if !ok {
+			return
+		}
+
+		if b.destination == "" {
+			b.destination = ev.History.Destination
+		}
+
+		for p, row := range b.rows {
+			if row.state != transferCompleted {
+				delete(b.rows, p)
+			}
+		}
+		b.order = slices.DeleteFunc(b.order, func(p string) bool { _, ok := b.rows[p]; return !ok })
+
+		if len(b.rows) == 0 {
+			delete(m.batches, ev.BatchID)
+			m.order = slices.DeleteFunc(m.order, func(id string) bool { return id == ev.BatchID })
+		}
+	}
+}
+
+// transferSnapshot is a batch as it is in the WAL, with its unfinished items.
+type transferSnapshot struct {
+	id, destination string
+	items           []wal.Item
+}
+
+// resync the model with the batches in the WAL, for when events were missed.
+// Completed rows stay like they do when their batch is removed, other rows that left the WAL are dropped.
+func (m *transfersModel) resync(batches []transferSnapshot) {
+	inWAL := make(map[string]map[string]bool, len(batches))
+	for _, snapshot := range batches {
+		items := make(map[string]bool, len(snapshot.items))
+		for _, item := range snapshot.items {
+			items[item.LocalPath] = true
+		}
+		inWAL[snapshot.id] = items
+	}
+
+	for id, b := range m.batches {
+		items, ok := inWAL[id]
+
+		for p, row := range b.rows {
+			if row.state != transferCompleted && !items[p] {
+				delete(b.rows, p)
+			}
+		}
+		b.order = slices.DeleteFunc(b.order, func(p string) bool { _, ok := b.rows[p]; return !ok })
+
+		if !ok && len(b.rows) == 0 {
+			delete(m.batches, id)
+			m.order = slices.DeleteFunc(m.order, func(bid string) bool { return bid == id })
+		}
+	}
+
+	m.load(batches)
+}
+
+// load batches from the WAL into the model, keeping the rows that aren't in them.
+func (m *transfersModel) load(batches []transferSnapshot) {
+	for _, snapshot := range batches {
+		m.addBatch(snapshot.id, snapshot.destination)
+		for _, item := range snapshot.items {
+			m.setItem(snapshot.id, item)
+		}
+	}
+}
+
+// updateProgress of the active rows, elapsed since the last update.
+func (m *transfersModel) updateProgress(active []activeUpload, elapsed time.Duration) {
+	for _, upload := range active {
+		b, ok := m.batches[upload.BatchID]
+		if !ok {
+			continue
+		}
+
+		row, ok := b.rows[upload.Item.LocalPath]
+		if !ok {
+			continue
+		}
+
+		if row.state == transferActive && elapsed > 0 && upload.Sent >= row.sent {
+			sample := float64(upload.Sent-row.sent) / elapsed.Seconds()
+			if row.rate == 0 {
+				row.rate = sample
+			} else {
+				row.rate = rateSmoothing*sample + (1-rateSmoothing)*row.rate
+			}
+		}
+
+		row.sent = upload.Sent
+	}
+}
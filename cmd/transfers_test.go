@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ctII/filebrowserui/wal"
+)
+
+func TestTransfersModel(t *testing.T) {
+	t.Parallel()
+
+	m := newTransfersModel()
+
+	m.apply(wal.Event{Type: wal.BatchCreated, BatchID: "1"}, "/remote")
+	for _, p := range []string{"/a", "/b", "/c"} {
+		m.apply(wal.Event{Type: wal.ItemStarted, BatchID: "1", Item: wal.Item{LocalPath: p, Size: 100, State: wal.StatePending}}, "")
+	}
+
+	m.apply(wal.Event{Type: wal.ItemUpdated, BatchID: "1", Item: wal.Item{LocalPath: "/a", Size: 100, State: wal.StateUploading}}, "")
+	m.apply(wal.Event{Type: wal.ItemFailed, BatchID: "1", Item: wal.Item{LocalPath: "/b", Size: 100, State: wal.StateFailed, LastError: "timeout"}}, "")
+	m.apply(wal.Event{Type: wal.ItemRemoved, BatchID: "1", Item: wal.Item{LocalPath: "/c"}}, "")
+
+	b := m.batches["1"]
+	if b.summary() != "/remote: 1 active, 1 failed" {
+		t.Fatalf("unexpected summary (%v)", b.summary())
+	}
+
+	m.updateProgress([]activeUpload{{BatchID: "1", Item: wal.Item{LocalPath: "/a"}, Sent: 20}}, 2*time.Second)
+
+	a := b.rows["/a"]
+	if a.sent != 20 || a.rate != 10 {
+		t.Fatalf("expected 20 bytes sent at 10 bytes/s, got %v at %v", a.sent, a.rate)
+	}
+
+	if a.eta() != 8*time.Second {
+		t.Fatalf("expected 8s left, got %v", a.eta())
+	}
+
+	m.apply(wal.Event{Type: wal.ItemFinished, BatchID: "1", Item: wal.Item{LocalPath: "/a", Size: 100, State: wal.StateUploading}}, "")
+	if a.state != transferCompleted || a.progress() != 1 || a.eta() != 0 {
+		t.Fatalf("unexpected finished row %+v", a)
+	}
+
+	// only completed rows stay after the batch is gone
+	m.apply(wal.Event{Type: wal.BatchRemoved, BatchID: "1"}, "")
+	if len(b.rows) != 1 || len(b.order) != 1 || b.order[0] != "/a" {
+		t.Fatalf("expected only the completed row to stay, got %v", b.order)
+	}
+
+	m.apply(wal.Event{Type: wal.BatchCreated, BatchID: "2"}, "/other")
+	m.apply(wal.Event{Type: wal.BatchRemoved, BatchID: "2"}, "")
+	if _, ok := m.batches["2"]; ok || len(m.order) != 1 {
+		t.Fatalf("expected an empty removed batch to leave the panel, got %v", m.order)
+	}
+}
+
+func TestTransfersModelResync(t *testing.T) {
+	t.Parallel()
+
+	m := newTransfersModel()
+
+	m.apply(wal.Event{Type: wal.BatchCreated, BatchID: "1"}, "/remote")
+	for _, p := range []string{"/done", "/active", "/queued"} {
+		m.apply(wal.Event{Type: wal.ItemStarted, BatchID: "1", Item: wal.Item{LocalPath: p, Size: 100, State: wal.StateUploading}}, "")
+	}
+	m.apply(wal.Event{Type: wal.ItemFinished, BatchID: "1", Item: wal.Item{LocalPath: "/done", Size: 100}}, "")
+	m.apply(wal.Event{Type: wal.BatchCreated, BatchID: "2"}, "/gone")
+
+	// the events of /queued finishing and of batch 2 being removed were missed
+	m.resync([]transferSnapshot{
+		{id: "1", destination: "/remote", items: []wal.Item{{LocalPath: "/active", Size: 100, State: wal.StateUploading}}},
+		{id: "3", destination: "/new", items: []wal.Item{{LocalPath: "/x", Size: 1}}},
+	})
+
+	b := m.batches["1"]
+	if len(b.rows) != 2 || b.rows["/done"].state != transferCompleted || b.rows["/active"].state != transferActive {
+		t.Fatalf("expected the completed and the active row to stay, got %v", b.order)
+	}
+
+	if _, ok := m.batches["2"]; ok {
+		t.Fatal("expected the batch that left the WAL to leave the panel")
+	}
+
+	if len(m.order) != 2 || m.order[1] != "3" || m.batches["3"].rows["/x"] == nil {
+		t.Fatalf("expected the missed batch to be added, got %v", m.order)
+	}
+}
+
+func TestTransferNodeID(t *testing.T) {
+	t.Parallel()
+
+	bid, localPath, isItem := parseTransferNodeID(transferItemNodeID("\x01", "/home/a b"))
+	if bid != "\x01" || localPath != "/home/a b" || !isItem {
+		t.Fatalf("unexpected item node id parts (%q, %q, %v)", bid, localPath, isItem)
+	}
+
+	bid, _, isItem = parseTransferNodeID(transferBatchNodeID("\x01"))
+	if bid != "\x01" || isItem {
+		t.Fatalf("unexpected batch node id parts (%q, %v)", bid, isItem)
+	}
+}
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// placeholder children shown by a treeLoader while a branch loads or after it failed to.
+// Paths never contain a NUL, so they can't collide with a node.
+const (
+	treeLoadingPrefix = "\x00loading\x00"
+	treeErrorPrefix   = "\x00error\x00"
+)
+
+// treeLoadingID of the placeholder child of the branch id while it loads.
+func treeLoadingID(id widget.TreeNodeID) widget.TreeNodeID { return treeLoadingPrefix + id }
+
+// treeErrorID of the placeholder child of the branch id when it failed to load.
+func treeErrorID(id widget.TreeNodeID) widget.TreeNodeID { return treeErrorPrefix + id }
+
+// treePlaceholder returns the branch of a placeholder id, and if it is an error.
+func treePlaceholder(id widget.TreeNodeID) (branch widget.TreeNodeID, isError bool, ok bool) {
+	if branch, ok := strings.CutPrefix(id, treeLoadingPrefix); ok {
+		return branch, false, true
+	}
+	if branch, ok := strings.CutPrefix(id, treeErrorPrefix); ok {
+		return branch, true, true
+	}
+	return "", false, false
+}
+
+// treeLoaderNode is the state of a branch in a treeLoader.
+type treeLoaderNode struct {
+	children []widget.TreeNodeID
+	loaded   bool
+	err      error
+
+	// loading and cancel are non-nil while the branch is loading
+	loading context.Context
+	cancel  context.CancelFunc
+}
+
+// treeLoader loads the children of a widget.Tree in the background, showing placeholders while they load.
+// It must only be used on the fyne goroutine.
+type treeLoader struct {
+	cache *NodeCache
+
+	// dirsOnly lists only directories as children
+	dirsOnly bool
+
+	// refresh the branch id of the tree after it loaded
+	refresh func(id widget.TreeNodeID)
+
+	// do runs the result of a load on the fyne goroutine
+	do func(func())
+
+	nodes map[widget.TreeNodeID]*treeLoaderNode
+
+	// dirs is true for every path listed as a directory
+	dirs map[widget.TreeNodeID]bool
+
+	// pinned branches in the cache, the open ones
+	pinned map[widget.TreeNodeID]bool
+
+	// prefetching subdirectories of the branch last loaded, stopped by cancelPrefetch
+	prefetching    widget.TreeNodeID
+	cancelPrefetch context.CancelFunc
+
+	unsubscribe func()
+}
+
+func newTreeLoader(cache *NodeCache, dirsOnly bool, refresh func(id widget.TreeNodeID)) *treeLoader {
+	l := &treeLoader{
+		cache:    cache,
+		dirsOnly: dirsOnly,
+		refresh:  refresh,
+		do:       fyne.Do,
+		nodes:    make(map[widget.TreeNodeID]*treeLoaderNode),
+		dirs:     make(map[widget.TreeNodeID]bool),
+		pinned:   make(map[widget.TreeNodeID]bool),
+	}
+	l.unsubscribe = cache.OnRevalidated(l.revalidated)
+
+	return l
+}
+
+// close the loader, cancelling every load and unpinning every branch.
+func (l *treeLoader) close() {
+	l.unsubscribe()
+
+	for id := range l.nodes {
+		l.cancel(id)
+	}
+
+	for id := range l.pinned {
+		l.cache.Unpin(id)
+	}
+	clear(l.pinned)
+
+	l.stopPrefetch()
+}
+
+// opened branch id, which the cache keeps until closed.
+func (l *treeLoader) opened(id widget.TreeNodeID) {
+	if l.pinned[id] {
+		return
+	}
+
+	l.pinned[id] = true
+	l.cache.Pin(id)
+}
+
+// closed branch id, cancelling its load.
+func (l *treeLoader) closed(id widget.TreeNodeID) {
+	l.cancel(id)
+
+	if l.prefetching == id {
+		l.stopPrefetch()
+	}
+
+	if l.pinned[id] {
+		delete(l.pinned, id)
+		l.cache.Unpin(id)
+	}
+}
+
+// node of id, created if it doesn't exist.
+func (l *treeLoader) node(id widget.TreeNodeID) *treeLoaderNode {
+	node, ok := l.nodes[id]
+	if !ok {
+		node = &treeLoaderNode{}
+		l.nodes[id] = node
+	}
+	return node
+}
+
+// children of id for widget.Tree, starting to load them if they aren't.
+func (l *treeLoader) children(id widget.TreeNodeID) []widget.TreeNodeID {
+	if _, _, ok := treePlaceholder(id); ok {
+		return nil
+	}
+
+	node := l.node(id)
+	switch {
+	case node.err != nil:
+		return []widget.TreeNodeID{treeErrorID(id)}
+	case node.loaded:
+		return node.children
+	case node.cancel == nil:
+		l.load(id, node)
+	}
+
+	return []widget.TreeNodeID{treeLoadingID(id)}
+}
+
+// isBranch for widget.Tree, true for the root and for anything listed as a directory.
+func (l *treeLoader) isBranch(id widget.TreeNodeID) bool {
+	if _, _, ok := treePlaceholder(id); ok {
+		return false
+	}
+	return id == "" || id == "/" || l.dirs[id]
+}
+
+// setDir records whether the node id is a directory, for nodes selected before their parent was loaded.
+func (l *treeLoader) setDir(id widget.TreeNodeID, isDir bool) {
+	l.dirs[id] = isDir
+}
+
+// load the children of id in the background.
+func (l *treeLoader) load(id widget.TreeNodeID, node *treeLoaderNode) {
+	ctx, cancel := context.WithCancel(context.Background())
+	node.loading, node.cancel = ctx, cancel
+
+	go func() {
+		defer cancel()
+
+		res, err := l.cache.Info(ctx, id)
+
+		l.do(func() {
+			// cancelled, or replaced by a newer load
+			if l.nodes[id] != node || node.loading != ctx {
+				return
+			}
+			node.loading, node.cancel = nil, nil
+
+			if err != nil {
+				slog.Error("could not load tree branch", "path", id, "error", err)
+				node.err = err
+				notifications.add(notifyError, fmt.Sprintf("could not load (%v): %v", id, err))
+				l.refresh(id)
+				return
+			}
+
+			// only loading a branch the first time is navigating into it, not revalidating it
+			if !node.loaded {
+				l.prefetch(id, res)
+			}
+
+			node.children = node.children[:0]
+			for i := range res.Items {
+				if l.dirsOnly && !res.Items[i].IsDir {
+					continue
+				}
+
+				l.dirs[res.Items[i].Path] = res.Items[i].IsDir
+				node.children = append(node.children, res.Items[i].Path)
+			}
+			node.loaded = true
+
+			l.refresh(id)
+		})
+	}()
+}
+
+// prefetch the subdirectories of the branch id listed by res, stopping to prefetch the previous branch.
+func (l *treeLoader) prefetch(id widget.TreeNodeID, res *Resource) {
+	l.stopPrefetch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.prefetching, l.cancelPrefetch = id, cancel
+
+	l.cache.Prefetch(ctx, res)
+}
+
+// stopPrefetch of the branch last loaded.
+func (l *treeLoader) stopPrefetch() {
+	if l.cancelPrefetch != nil {
+		l.cancelPrefetch()
+		l.prefetching, l.cancelPrefetch = "", nil
+	}
+}
+
+// err of the branch id, nil if it loaded or is loading.
+func (l *treeLoader) err(id widget.TreeNodeID) error {
+	if node, ok := l.nodes[id]; ok {
+		return node.err
+	}
+	return nil
+}
+
+// loaded is true once the children of the branch id are known.
+func (l *treeLoader) loaded(id widget.TreeNodeID) bool {
+	node, ok := l.nodes[id]
+	return ok && node.loaded
+}
+
+// errText of the branch id for a single line, empty if it didn't fail.
+func (l *treeLoader) errText(id widget.TreeNodeID) string {
+	err := l.err(id)
+	if err == nil {
+		return ""
+	}
+	return strings.ReplaceAll(err.Error(), "\n", " ")
+}
+
+// ids of the nodes shown for the cached path p, the root may be "" or "/".
+func (l *treeLoader) ids(p string) []widget.TreeNodeID {
+	if p == "/" {
+		return []widget.TreeNodeID{"", "/"}
+	}
+	return []widget.TreeNodeID{p}
+}
+
+// revalidate id in the background if it is loaded, showing its current children until it has.
+// Branches that failed to load are loaded again the next time they're shown.
+func (l *treeLoader) revalidate(id widget.TreeNodeID) {
+	node, ok := l.nodes[id]
+	switch {
+	case !ok:
+	case node.err != nil:
+		delete(l.nodes, id)
+		l.refresh(id)
+	case node.loaded && node.cancel == nil:
+		l.load(id, node)
+	}
+}
+
+// revalidated path of the cache, called on any goroutine.
+func (l *treeLoader) revalidated(p string) {
+	l.do(func() {
+		for _, id := range l.ids(p) {
+			l.revalidate(id)
+		}
+	})
+}
+
+// refreshTree of prefix, fetching it and every loaded branch below it from filebrowser again.
+func (l *treeLoader) refreshTree(prefix string) {
+	prefix = nodeKey(prefix)
+	l.cache.InvalidateTree(prefix)
+
+	for id := range l.nodes {
+		key := nodeKey(id)
+		if prefix == "/" || key == prefix || strings.HasPrefix(key, prefix+"/") {
+			l.revalidate(id)
+		}
+	}
+}
+
+// cancel loading id, for when its branch is closed. It starts loading again when opened.
+func (l *treeLoader) cancel(id widget.TreeNodeID) {
+	node, ok := l.nodes[id]
+	if !ok || node.cancel == nil {
+		return
+	}
+
+	node.cancel()
+	node.loading, node.cancel = nil, nil
+}
+
+// reload id the next time its children are asked for, fetching it from filebrowser again.
+func (l *treeLoader) reload(id widget.TreeNodeID) {
+	l.cancel(id)
+	delete(l.nodes, id)
+	l.cache.Invalidate(id)
+	l.refresh(id)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+func TestTreePlaceholder(t *testing.T) {
+	t.Parallel()
+
+	for _, id := range []string{"", "/", "/a/b"} {
+		if branch, isError, ok := treePlaceholder(treeLoadingID(id)); !ok || isError || branch != id {
+			t.Fatalf("expected loading placeholder of (%v), got (%v, %v, %v)", id, branch, isError, ok)
+		}
+
+		if branch, isError, ok := treePlaceholder(treeErrorID(id)); !ok || !isError || branch != id {
+			t.Fatalf("expected error placeholder of (%v), got (%v, %v, %v)", id, branch, isError, ok)
+		}
+
+		if _, _, ok := treePlaceholder(id); ok {
+			t.Fatalf("expected (%v) to not be a placeholder", id)
+		}
+	}
+}
+
+func TestTreeLoader(t *testing.T) {
+	t.Parallel()
+
+	// started and cancelled are closed when the request for /slow is received and cancelled
+	started, cancelled := make(chan struct{}), make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/resources", "/api/resources/":
+			_, _ = w.Write([]byte(`{"path":"/","isDir":true,"items":[{"path":"/a","isDir":true},{"path":"/b"}]}`))
+		case "/api/resources/a":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/api/resources/slow":
+			close(started)
+			<-r.Context().Done()
+			close(cancelled)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var refreshed []widget.TreeNodeID
+	loader := newTreeLoader(NewNodeCache(&filebrowserSession{host: srv.URL}, NodeCacheOptions{}), false, func(id widget.TreeNodeID) {
+		refreshed = append(refreshed, id)
+	})
+
+	// the test goroutine stands in for the fyne goroutine
+	done := make(chan func(), 1)
+	loader.do = func(f func()) { done <- f }
+
+	// waitRefresh of the branch id
+	waitRefresh := func(id widget.TreeNodeID) {
+		t.Helper()
+
+		refreshed = nil
+		for !slices.Contains(refreshed, id) {
+			select {
+			case f := <-done:
+				f()
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for the branch (%v) to be refreshed", id)
+			}
+		}
+	}
+
+	if children := loader.children(""); !slices.Equal(children, []string{treeLoadingID("")}) {
+		t.Fatalf("expected loading placeholder, got (%q)", children)
+	}
+	waitRefresh("")
+
+	if children := loader.children(""); !slices.Equal(children, []string{"/a", "/b"}) {
+		t.Fatalf("expected children (/a, /b), got (%q)", children)
+	}
+
+	if !loader.isBranch("") || !loader.isBranch("/a") || loader.isBranch("/b") || loader.isBranch(treeLoadingID("/a")) {
+		t.Fatal("expected the root and /a to be the only branches")
+	}
+
+	loader.children("/a")
+	waitRefresh("/a")
+
+	if children := loader.children("/a"); !slices.Equal(children, []string{treeErrorID("/a")}) {
+		t.Fatalf("expected error placeholder, got (%q)", children)
+	}
+
+	if loader.errText("/a") == "" {
+		t.Fatal("expected the error of /a")
+	}
+
+	loader.reload("/a")
+
+	if children := loader.children("/a"); !slices.Equal(children, []string{treeLoadingID("/a")}) {
+		t.Fatalf("expected loading placeholder after reloading, got (%q)", children)
+	}
+	waitRefresh("/a")
+
+	// refreshing keeps showing the children until they were fetched again
+	loader.refreshTree("/")
+	if children := loader.children(""); !slices.Equal(children, []string{"/a", "/b"}) {
+		t.Fatalf("expected children (/a, /b) while refreshing, got (%q)", children)
+	}
+	waitRefresh("")
+
+	loader.children("/slow")
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the request of /slow")
+	}
+
+	loader.cancel("/slow")
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the request to be cancelled")
+	}
+
+	if children := loader.children("/slow"); !slices.Equal(children, []string{treeLoadingID("/slow")}) {
+		t.Fatalf("expected loading placeholder after cancelling, got (%q)", children)
+	}
+}
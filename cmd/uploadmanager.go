@@ -2,9 +2,19 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ctII/filebrowserui/wal"
 )
@@ -13,10 +23,29 @@ import (
 
 internal documention:
 
+Every upload is a wal.Batch of wal.Items, the WAL is the source of truth and is written before anything is sent to the server.
+distributeBatches receives batches and starts a goroutine per batch, which walks the unfinished items of the batch
+and uploads each of them once it gets one of the slots shared by every batch.
+
+An item is marked uploading before any bytes are sent, and is only removed from the batch (wal.Batch.Finish) once the server
+confirmed every byte. If we crash in between the item is still in the WAL and resumed on the next start, filebrowser's TUS
+endpoint tells us how many bytes it already has.
+
 */
 
-type cancellableQueue struct {
-}
+const (
+	// defaultUploadSlots is how many files are uploaded at the same time, across all batches.
+	defaultUploadSlots = 3
+
+	// maxItemAttempts before a failed item is no longer retried automatically when resuming.
+	maxItemAttempts = 5
+
+	// maxResumableRetries of a single attempt when the server closes the connection early.
+	maxResumableRetries = 3
+
+	// pausedOffsetTimeout of asking the server how much of a paused item it has.
+	pausedOffsetTimeout = 5 * time.Second
+)
 
 // uploadManager manages the paused, running, and failed uploads to the server
 // as well as the ones that crashed and must be resumed.
@@ -28,9 +57,83 @@ type uploadManager struct {
 	onGeneralError   func(err error)
 
 	batchChannel chan wal.Batch
-	stopChannel  chan error
 
-	queue cancellableQueue
+	// ctx is cancelled by Stop, stopping every upload
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// slots limits how many items are uploaded at the same time
+	slots chan struct{}
+
+	// workers is every goroutine started by the uploadManager, Stop waits on them
+	workers sync.WaitGroup
+
+	// draining is closed by Drain, no new items are started once it is closed
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	// running batches, so the same batch is never uploaded twice at once
+	runningMu sync.Mutex
+	running   map[string]uploadWork
+
+	// active items being uploaded right now, keyed by activeKey
+	activeMu sync.Mutex
+	active   map[string]*activeItem
+}
+
+var (
+	// errItemPaused is the cancel cause of an item paused by the user.
+	errItemPaused = errors.New("upload paused")
+	// errItemCancelled is the cancel cause of an item cancelled by the user.
+	errItemCancelled = errors.New("upload cancelled")
+	// errItemNotUploadable is returned when an item changed state before it could be started.
+	errItemNotUploadable = errors.New("item is no longer waiting to be uploaded")
+)
+
+// activeItem being uploaded.
+type activeItem struct {
+	batchID string
+	item    wal.Item
+
+	// cancel the upload of the item, with errItemPaused or errItemCancelled as the cause
+	cancel context.CancelCauseFunc
+
+	// sent is the position of the upload in the local file
+	sent atomic.Int64
+}
+
+// activeUpload is a snapshot of an activeItem.
+type activeUpload struct {
+	BatchID string
+	Item    wal.Item
+
+	// Sent is how many bytes of the file were read to be sent to the server, including the ones skipped by resuming.
+	Sent int64
+}
+
+// progressReader records the position of an upload in the file it reads.
+type progressReader struct {
+	io.ReadSeeker
+	sent *atomic.Int64
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.sent.Add(int64(n))
+	return n, err
+}
+
+func (r progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		r.sent.Store(pos)
+	}
+	return pos, err
+}
+
+// activeKey of an item in the batch with bid.
+func activeKey(bid string, localPath string) string {
+	return bid + "\x00" + localPath
 }
 
 // removeIndexFromSlice by modifying the slice and returning the result, modifying the content of the original slice
@@ -38,133 +141,755 @@ func removeIndexFromSlice[S any](s []S, index int) []S {
 	return slices.Clip(slices.Delete(s, index, index+1))
 }
 
-func (um *uploadManager) startItem(ctx context.Context, path string) {
+// shouldUpload item when walking its batch, paused items and items that failed too many times wait for the user.
+func shouldUpload(item wal.Item) bool {
+	switch item.State {
+	case wal.StatePending, wal.StateUploading:
+		return true
+	case wal.StateFailed:
+		return item.Attempts < maxItemAttempts
+	default:
+		return false
+	}
+}
+
+// uploadItem to the server, returning once every byte was confirmed. sent is updated with the position in the file.
+// confirmedBytes of item, the offset the server has of its remote file.
+func (um *uploadManager) confirmedBytes(item wal.Item) (int64, error) {
+	if !item.RemoteCreated {
+		return 0, errors.New("remote file was not created yet")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pausedOffsetTimeout)
+	defer cancel()
+
+	return um.fb.headTUSFile(ctx, path.Clean(item.RemotePath))
+}
+
+func (um *uploadManager) uploadItem(ctx context.Context, item wal.Item, sent *atomic.Int64) (err error) {
+	f, err := os.Open(item.LocalPath)
+	if err != nil {
+		return fmt.Errorf("could not open file: %w", err)
+	}
+	defer func() {
+		if err2 := f.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close file: %w", err2))
+		}
+	}()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat file: %w", err)
+	}
+
+	// the server resumes based on the byte offset, a different file would be silently corrupted
+	if stat.Size() != item.Size {
+		return fmt.Errorf("file changed size since it was added to the upload (%v bytes, now %v bytes)", item.Size, stat.Size())
+	}
+
+	dir, name := path.Split(item.RemotePath)
+
+	for retries := 0; ; retries++ {
+		err = um.fb.uploadReader(ctx, dir, name, progressReader{ReadSeeker: f, sent: sent}, stat.Size(), false)
+		if err == nil || !errors.As(err, &ErrResumable{}) || retries == maxResumableRetries {
+			return err
+		}
+
+		slog.Debug("retrying resumable upload error", "path", item.LocalPath, "error", err)
+	}
+}
+
+// conflictName is the n-th alternative name of p for wal.ConflictRename, ex: "/a/photo (2).jpg".
+func conflictName(p string, n int) string {
+	if n == 0 {
+		return p
+	}
+
+	dir, name := path.Split(p)
+
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if stem == "" { // dotfiles like ".bashrc" are all extension
+		stem, ext = name, ""
+	}
+
+	return fmt.Sprintf("%v%v (%v)%v", dir, stem, n, ext)
+}
+
+// maxConflictNames tried by wal.ConflictRename before giving up.
+const maxConflictNames = 1000
+
+// resolveConflict of item with an existing file at its RemotePath according to policy, creating the remote file.
+// Returns skip if the item must be finished without uploading it.
+func (um *uploadManager) resolveConflict(ctx context.Context, item *wal.Item, policy wal.ConflictPolicy) (skip bool, err error) {
+	switch policy {
+	case wal.ConflictOverwrite:
+		return false, um.fb.createTUSFile(ctx, item.RemotePath, true)
+	case wal.ConflictSkip:
+		_, err := um.fb.Info(ctx, item.RemotePath)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ErrResourceNotFound) {
+			return false, fmt.Errorf("could not check if (%v) exists: %w", item.RemotePath, err)
+		}
+
+		return false, um.fb.createTUSFile(ctx, item.RemotePath, false)
+	case wal.ConflictRename:
+		for n := range maxConflictNames {
+			candidate := conflictName(item.RemotePath, n)
+
+			_, err := um.fb.Info(ctx, candidate)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrResourceNotFound) {
+				return false, fmt.Errorf("could not check if (%v) exists: %w", candidate, err)
+			}
+
+			item.RemotePath = candidate
+			return false, um.fb.createTUSFile(ctx, item.RemotePath, false)
+		}
+
+		return false, fmt.Errorf("could not find a free name for (%v) after %v tries", item.RemotePath, maxConflictNames)
+	default:
+		return false, fmt.Errorf("unknown conflict policy (%v)", policy)
+	}
+}
+
+// startItem of batch b, recording its progress in the WAL.
+func (um *uploadManager) startItem(ctx context.Context, b wal.Batch, item wal.Item, policy wal.ConflictPolicy) {
+	// the item may have been paused or cancelled since the batch was walked
+	err := b.UpdateItem(item.LocalPath, func(i *wal.Item) error {
+		if !shouldUpload(*i) {
+			return errItemNotUploadable
+		}
+
+		i.State = wal.StateUploading
+		i.Attempts++
+		item = *i
+		return nil
+	})
+	if errors.Is(err, errItemNotUploadable) || errors.Is(err, wal.ErrItemNotFound) {
+		return
+	}
+	if err != nil {
+		um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("could not mark item as uploading: %w", err))
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	active := &activeItem{batchID: b.ID(), item: item, cancel: cancel}
+	active.sent.Store(item.BytesConfirmed)
+
+	key := activeKey(b.ID(), item.LocalPath)
+	um.activeMu.Lock()
+	um.active[key] = active
+	um.activeMu.Unlock()
+	defer func() {
+		um.activeMu.Lock()
+		delete(um.active, key)
+		um.activeMu.Unlock()
+	}()
+
+	var uploadErr error
+	if !item.RemoteCreated {
+		var skip bool
+		skip, uploadErr = um.resolveConflict(ctx, &item, policy)
+
+		if uploadErr == nil && skip {
+			slog.Info("skipping upload of file that exists on the server", "path", item.RemotePath)
+			if err := b.Skip(item.LocalPath); err != nil {
+				um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("skipped, but could not record it: %w", err))
+			}
+			return
+		}
+
+		if uploadErr == nil {
+			uploadErr = b.UpdateItem(item.LocalPath, func(i *wal.Item) error {
+				i.RemotePath = item.RemotePath
+				i.RemoteCreated = true
+				return nil
+			})
+			item.RemoteCreated = uploadErr == nil
+		}
+	}
+
+	if uploadErr == nil {
+		uploadErr = um.uploadItem(ctx, item, &active.sent)
+	}
+
+	if uploadErr == nil {
+		if err := b.Finish(item.LocalPath); err != nil {
+			um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("uploaded, but could not record it: %w", err))
+		}
+		return
+	}
+
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errItemPaused):
+		// what was read from the file may not have reached the server, only its offset is confirmed
+		confirmed, offsetErr := um.confirmedBytes(item)
+		if offsetErr != nil {
+			slog.Debug("could not get offset of paused item, keeping the confirmed bytes", "path", item.LocalPath, "error", offsetErr)
+		}
+
+		err = b.UpdateItem(item.LocalPath, func(i *wal.Item) error {
+			i.State = wal.StatePaused
+			i.Attempts--
+			if offsetErr == nil {
+				i.BytesConfirmed = confirmed
+			}
+			return nil
+		})
+		if err != nil {
+			um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("could not mark paused item as paused: %w", err))
+		}
+		return
+	case errors.Is(cause, errItemCancelled):
+		if err := b.RemoveItem(item.LocalPath); err != nil {
+			um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("could not remove cancelled item: %w", err))
+		}
+		return
+	}
+
+	// stopped, not failed. it will be resumed from the WAL
+	if ctx.Err() != nil {
+		err = b.UpdateItem(item.LocalPath, func(i *wal.Item) error {
+			i.State = wal.StatePending
+			i.Attempts--
+			return nil
+		})
+		if err != nil {
+			um.onBatchItemError(b.ID(), item.LocalPath, fmt.Errorf("could not mark stopped item as pending: %w", err))
+		}
+		return
+	}
+
+	err = b.UpdateItem(item.LocalPath, func(i *wal.Item) error {
+		i.State = wal.StateFailed
+		i.LastError = uploadErr.Error()
+		return nil
+	})
+	if err != nil {
+		uploadErr = errors.Join(uploadErr, fmt.Errorf("could not mark item as failed: %w", err))
+	}
 
+	um.onBatchItemError(b.ID(), item.LocalPath, uploadErr)
 }
 
-func (um *uploadManager) startUploadingBatch(b wal.Batch, finished func(), cancel chan struct{}) {
+func (um *uploadManager) startUploadingBatch(ctx context.Context, b wal.Batch, rewalk *atomic.Bool, finished func()) {
 	defer finished()
 
-	// TODO: maybe get list from distribute batches instead of calling batch list
-	unfinishedUploads, err := b.ListUnfinished()
+	policy, err := b.ConflictPolicy()
 	if err != nil {
-		// TODO: throw a better error with the ability to cancel an item out of this batch
 		um.onGeneralError(err)
 		return
 	}
 
-	for _, unfinishedFilePath := range unfinishedUploads {
+	for {
+		rewalk.Store(false)
+
+		if !um.walkBatch(ctx, b, policy) || !rewalk.Load() {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case <-um.draining:
+		return
+	default:
+	}
+
+	if err := um.removeBatchIfDone(b); err != nil {
+		um.onGeneralError(err)
+	}
+}
+
+// walkBatch b once, uploading every item that should be uploaded. Returns false if it was stopped.
+func (um *uploadManager) walkBatch(ctx context.Context, b wal.Batch, policy wal.ConflictPolicy) bool {
+	var items sync.WaitGroup
+	defer items.Wait()
+
+	for item, err := range b.UnfinishedItems() {
+		if err != nil {
+			// TODO: throw a better error with the ability to cancel an item out of this batch
+			um.onGeneralError(err)
+			return false
+		}
+
+		if !shouldUpload(item) {
+			continue
+		}
+
+		// TODO: maybe some algo that checks the max number of files we should upload by testing
 		select {
-		case <-cancel:
-			// Did we get cancelled?
+		case <-ctx.Done():
+			return false
+		case <-um.draining:
+			return false
+		case um.slots <- struct{}{}:
+		}
+
+		// the slot may have been free at the same time as draining started
+		select {
+		case <-um.draining:
+			<-um.slots
+			return false
 		default:
 		}
 
+		items.Add(1)
 		go func() {
-			// TODO: start item in the queue and limit by a user-defined variable
-			// maybe some algo that checks the max number of files we should upload by testing
-			_ = unfinishedFilePath
+			defer items.Done()
+			defer func() { <-um.slots }()
+
+			um.startItem(ctx, b, item, policy)
 		}()
 	}
 
-	// TODO: maybe add a whole list to the batch at once
+	items.Wait()
+
+	return ctx.Err() == nil
+}
+
+// removeBatchIfDone from the WAL, moving it to the history once nothing is left to upload.
+func (um *uploadManager) removeBatchIfDone(b wal.Batch) error {
+	for _, err := range b.UnfinishedItems() {
+		if err != nil {
+			return fmt.Errorf("could not list unfinished items for (%v): %w", b.ID(), err)
+		}
+
+		return nil
+	}
+
+	if err := um.wal.RemoveBatch(b); err != nil {
+		return fmt.Errorf("could not remove finished batch: %w", err)
+	}
+
+	return nil
 }
 
 type uploadWork struct {
 	// batch to be working on
 	batch wal.Batch
 
-	// should the uploadBatch worker stop its work?
-	cancel chan struct{}
+	// rewalk is set when an item of the batch became uploadable again while the batch was being walked
+	rewalk *atomic.Bool
+
+	// cancel the uploadBatch worker
+	cancel context.CancelFunc
+}
+
+// runBatch unless it is already running.
+func (um *uploadManager) runBatch(batch wal.Batch) {
+	um.runningMu.Lock()
+	defer um.runningMu.Unlock()
+
+	if _, ok := um.running[batch.ID()]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(um.ctx)
+	work := uploadWork{
+		batch:  batch,
+		rewalk: &atomic.Bool{},
+		cancel: cancel,
+	}
+	um.running[batch.ID()] = work
+
+	um.workers.Add(1)
+	go um.startUploadingBatch(ctx, batch, work.rewalk, func() {
+		um.runningMu.Lock()
+		delete(um.running, batch.ID())
+		um.runningMu.Unlock()
+
+		cancel()
+		um.workers.Done()
+	})
 }
 
 func (um *uploadManager) distributeBatches() {
-	var (
-		batchesMu sync.Mutex
-		batches   map[string]uploadWork
-	)
+	defer um.workers.Done()
+
 	for {
 		select {
-		case <-um.stopChannel:
-			um.stopChannel <- nil
+		case <-um.ctx.Done():
+			return
+		case <-um.draining:
+			return
 		case batch := <-um.batchChannel:
-			work := uploadWork{
-				batch:  batch,
-				cancel: make(chan struct{}),
+			um.runBatch(batch)
+		}
+	}
+}
+
+// queueBatch to be uploaded by the distributeBatches goroutine.
+func (um *uploadManager) queueBatch(batch wal.Batch) error {
+	select {
+	case <-um.ctx.Done():
+		return errors.New("upload manager is stopped, the upload will start the next time filebrowserui starts")
+	case <-um.draining:
+		return errors.New("upload manager is shutting down, the upload will start the next time filebrowserui starts")
+	case um.batchChannel <- batch:
+		return nil
+	}
+}
+
+// newBatchItems for the local path p that will be uploaded into the remote directory dir.
+// A directory is walked, keeping its name and layout under dir.
+func newBatchItems(dir string, p string) ([]wal.Item, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, fmt.Errorf("could not get absolute path: %w", err)
+	}
+
+	var items []wal.Item
+
+	root := filepath.Dir(abs)
+	err = filepath.WalkDir(abs, func(local string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			if !d.IsDir() {
+				slog.Info("skipping upload of file that is not a regular file", "path", local, "type", d.Type().String())
 			}
-			batchesMu.Lock()
-			batches[batch.ID()] = work
-			batchesMu.Unlock()
+			return nil
+		}
 
-			go um.uploadBatch(batch, func() {
-				batchesMu.Lock()
-				delete(batches, batch.ID())
-				batchesMu.Unlock()
-			}, work.cancel)
+		stat, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat file (%v): %w", local, err)
+		}
+
+		rel, err := filepath.Rel(root, local)
+		if err != nil {
+			return fmt.Errorf("could not get path of (%v) relative to (%v): %w", local, root, err)
 		}
+
+		items = append(items, wal.Item{
+			LocalPath:  local,
+			RemotePath: path.Join(dir, filepath.ToSlash(rel)),
+			Size:       stat.Size(),
+			ModTime:    stat.ModTime(),
+			State:      wal.StatePending,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not walk (%v): %w", abs, err)
 	}
+
+	return items, nil
 }
 
 // TODO: how can the GUI cancel a batch? or maybe edit the list of files to be uploaded?
 // TODO: how does the GUI corrolate the specific batch error to starting an action (cancelling that batch or excluding a file and retrying)?
 // TODO: should begin upload return a batch wrapper for cancelling/editting?
 
-// BeginUpload of paths, returning no error if starting that upload was recorded.
-func (um *uploadManager) BeginUpload(dir string, paths []string) error {
+// checkPermissions of the user to upload into dir with policy, creating files and replacing them if policy overwrites.
+func (um *uploadManager) checkPermissions(dir string, policy wal.ConflictPolicy) error {
+	if !um.fb.can(permCreate) {
+		return fmt.Errorf("could not upload into (%v), creating files isn't allowed: %w", dir, ErrPermissionDenied)
+	}
+
+	if policy == wal.ConflictOverwrite && !um.fb.can(permModify) {
+		return fmt.Errorf("could not upload into (%v), replacing files isn't allowed: %w", dir, ErrPermissionDenied)
+	}
+
+	return nil
+}
+
+// BeginUpload of paths, files or directories, into the remote directory dir, handling files that already exist with policy.
+// Returns no error if starting that upload was recorded.
+func (um *uploadManager) BeginUpload(dir string, paths []string, policy wal.ConflictPolicy) error {
+	if err := um.checkPermissions(dir, policy); err != nil {
+		return err
+	}
+
 	batch, err := um.wal.NewBatch(dir)
 	if err != nil {
 		return fmt.Errorf("could not make new wal batch: %w", err)
 	}
 
+	if err = batch.SetConflictPolicy(policy); err != nil {
+		return fmt.Errorf("could not set conflict policy of the batch (%v): %w", batch.ID(), err)
+	}
+
+	items := make([]wal.Item, 0, len(paths))
 	for i := range paths {
-		if err = batch.Start(paths[i]); err != nil {
+		pathItems, err := newBatchItems(dir, paths[i])
+		if err != nil {
 			return fmt.Errorf("could not add path (%v) to the batch (%v): %w", paths[i], batch.ID(), err)
 		}
+
+		items = append(items, pathItems...)
 	}
 
-	// TODO tell uploadManager goroutine to start uploading this batch
-	um.batchChannel <- batch
+	if err = batch.StartMany(items); err != nil {
+		return fmt.Errorf("could not add paths to the batch (%v): %w", batch.ID(), err)
+	}
 
-	return nil
+	return um.queueBatch(batch)
 }
 
-// Start uploadManager goroutine. Returning once on-disk batches are sent to goroutine or an error occurs during disk loading
-func (um *uploadManager) Start() error {
-	// Get unfinished batches
-	batches, err := um.wal.ListBatches()
-	if err != nil {
-		return fmt.Errorf("could not list wal batches: %w", err)
-	}
-
-	// Do a quick cleanup of dangling batches (those without any unfinished uploads)
-	for i := range batches {
-		paths, err := batches[i].ListUnfinished()
+// Start uploadManager goroutine, returning the unfinished batches found in the WAL. They are not uploaded until passed to Resume.
+// Batches without any unfinished uploads are removed from the WAL.
+func (um *uploadManager) Start() ([]wal.Batch, error) {
+	// Get unfinished batches, doing a quick cleanup of dangling batches (those without any unfinished uploads)
+	var batches []wal.Batch
+	for batch, err := range um.wal.Batches() {
 		if err != nil {
-			return fmt.Errorf("could not list unfinished batches for (%v): %w", batches[i].ID(), err)
+			return nil, fmt.Errorf("could not list wal batches: %w", err)
+		}
+
+		dangling := true
+		for _, err := range batch.UnfinishedItems() {
+			if err != nil {
+				return nil, fmt.Errorf("could not list unfinished items for (%v): %w", batch.ID(), err)
+			}
+
+			dangling = false
+			break
 		}
 
-		if len(paths) != 0 {
+		if !dangling {
+			batches = append(batches, batch)
 			continue
 		}
 
-		if err = um.wal.RemoveBatch(batches[i]); err != nil {
-			return fmt.Errorf("could not remove batch: %w", err)
+		if err = um.wal.RemoveBatch(batch); err != nil {
+			return nil, fmt.Errorf("could not remove batch: %w", err)
 		}
 	}
 
 	// Start worker gorountine
+	um.workers.Add(1)
 	go um.distributeBatches()
 
+	return batches, nil
+}
+
+// Resume uploading batches, usually the ones returned by Start.
+// Batches the user isn't allowed to upload anymore are left in the WAL and returned as errors, the others are still resumed.
+func (um *uploadManager) Resume(batches []wal.Batch) error {
+	var errs []error
 	for i := range batches {
-		um.batchChannel <- batches[i]
+		dir, err := batches[i].Destination()
+		if err != nil {
+			return fmt.Errorf("could not get destination of the batch (%v): %w", batches[i].ID(), err)
+		}
+
+		policy, err := batches[i].ConflictPolicy()
+		if err != nil {
+			return fmt.Errorf("could not get conflict policy of the batch (%v): %w", batches[i].ID(), err)
+		}
+
+		if err := um.checkPermissions(dir, policy); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err := um.queueBatch(batches[i]); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Active items being uploaded right now, sorted by local path.
+func (um *uploadManager) Active() []activeUpload {
+	um.activeMu.Lock()
+	defer um.activeMu.Unlock()
+
+	uploads := make([]activeUpload, 0, len(um.active))
+	for _, active := range um.active {
+		uploads = append(uploads, activeUpload{BatchID: active.batchID, Item: active.item, Sent: active.sent.Load()})
+	}
+
+	slices.SortFunc(uploads, func(a, b activeUpload) int { return strings.Compare(a.Item.LocalPath, b.Item.LocalPath) })
+
+	return uploads
+}
+
+// batch of the WAL with the id bid.
+func (um *uploadManager) batch(bid string) (wal.Batch, error) {
+	for batch, err := range um.wal.Batches() {
+		if err != nil {
+			return wal.Batch{}, err
+		}
+
+		if batch.ID() == bid {
+			return batch, nil
+		}
+	}
+
+	return wal.Batch{}, fmt.Errorf("batch (%v) is not in the WAL", bid)
+}
+
+// stopActive upload of localPath in the batch bid with cause, returning false if it isn't being uploaded.
+func (um *uploadManager) stopActive(bid string, localPath string, cause error) bool {
+	um.activeMu.Lock()
+	defer um.activeMu.Unlock()
+
+	active, ok := um.active[activeKey(bid, localPath)]
+	if ok {
+		active.cancel(cause)
+	}
+
+	return ok
+}
+
+// Pause the upload of localPath in the batch bid, it isn't uploaded again until Retry.
+func (um *uploadManager) Pause(bid string, localPath string) error {
+	if um.stopActive(bid, localPath, errItemPaused) {
+		return nil
+	}
+
+	batch, err := um.batch(bid)
+	if err != nil {
+		return err
+	}
+
+	err = batch.UpdateItem(localPath, func(i *wal.Item) error {
+		// an item that started since the check above is stopped below instead
+		if i.State == wal.StateUploading {
+			return errItemNotUploadable
+		}
+
+		i.State = wal.StatePaused
+		return nil
+	})
+	if errors.Is(err, errItemNotUploadable) {
+		um.stopActive(bid, localPath, errItemPaused)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not pause (%v): %w", localPath, err)
+	}
+
+	return nil
+}
+
+// Cancel the upload of localPath in the batch bid, removing it from the batch. What was already sent stays on the server.
+func (um *uploadManager) Cancel(bid string, localPath string) error {
+	if um.stopActive(bid, localPath, errItemCancelled) {
+		return nil
+	}
+
+	batch, err := um.batch(bid)
+	if err != nil {
+		return err
+	}
+
+	if err := batch.RemoveItem(localPath); err != nil {
+		return fmt.Errorf("could not cancel (%v): %w", localPath, err)
+	}
+
+	// an item that started since the check above is stopped and removed once it notices
+	um.stopActive(bid, localPath, errItemCancelled)
+
+	if err := um.removeBatchIfDone(batch); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-// Stop uploadManager goroutine.
+// Retry the upload of a paused or failed localPath in the batch bid.
+func (um *uploadManager) Retry(bid string, localPath string) error {
+	batch, err := um.batch(bid)
+	if err != nil {
+		return err
+	}
+
+	err = batch.UpdateItem(localPath, func(i *wal.Item) error {
+		if i.State != wal.StatePaused && i.State != wal.StateFailed {
+			return errItemNotUploadable
+		}
+
+		if i.State == wal.StateFailed {
+			i.Attempts = 0
+		}
+		i.State = wal.StatePending
+		i.LastError = ""
+		return nil
+	})
+	if errors.Is(err, errItemNotUploadable) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not retry (%v): %w", localPath, err)
+	}
+
+	um.runningMu.Lock()
+	work, running := um.running[bid]
+	if running {
+		work.rewalk.Store(true)
+	}
+	um.runningMu.Unlock()
+
+	if running {
+		return nil
+	}
+
+	return um.queueBatch(batch)
+}
+
+// Drain the uploadManager by letting the items being uploaded finish without starting any others, then stopping it.
+// Items that were not started stay in the WAL for the next run. If ctx is done first the remaining uploads are stopped like Stop.
+func (um *uploadManager) Drain(ctx context.Context) error {
+	um.drainOnce.Do(func() { close(um.draining) })
+
+	drained := make(chan struct{})
+	go func() {
+		um.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	return um.Stop()
+}
+
+// Stop uploadManager goroutine, cancelling uploads in progress and waiting for every worker to record its state in the WAL.
 func (um *uploadManager) Stop() error {
-	return <-um.stopChannel
+	um.cancel()
+	um.workers.Wait()
+
+	return nil
+}
+
+// StopWithin timeout, cancelling uploads in progress like Stop but not waiting longer than timeout for them to record their state.
+// Items that could not be recorded are still marked uploading in the WAL, and are resumed on the next run like after a crash.
+func (um *uploadManager) StopWithin(timeout time.Duration) error {
+	um.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		um.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("uploads did not stop within %v", timeout)
+	}
 }
 
 // TODO: add option that filepath.Walks a directoy and starts uploads while it is still walking
@@ -175,12 +900,19 @@ func newUploadManager(
 	onBatchItemError func(bid string, path string, err error),
 	onGeneralError func(err error),
 ) (*uploadManager, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &uploadManager{
 		wal:              writeAheadLog,
 		fb:               session,
 		onBatchItemError: onBatchItemError,
 		onGeneralError:   onGeneralError,
 		batchChannel:     make(chan wal.Batch, 10),
-		stopChannel:      make(chan error),
+		ctx:              ctx,
+		cancel:           cancel,
+		slots:            make(chan struct{}, defaultUploadSlots),
+		draining:         make(chan struct{}),
+		running:          make(map[string]uploadWork),
+		active:           make(map[string]*activeItem),
 	}, nil
 }
@@ -1,8 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/ctII/filebrowserui/wal"
+	"go.etcd.io/bbolt"
 )
 
 func TestRemoveIndexFromSlice(t *testing.T) {
@@ -24,3 +39,577 @@ func TestRemoveIndexFromSlice(t *testing.T) {
 		t.Fatalf("s (%v) and newS (%v) should be the same", s, newS)
 	}
 }
+
+// newTestTUSServer that accepts uploads like filebrowser's TUS endpoint, storing them in files by path.
+// onPatch is called before every PATCH is stored if it isn't nil.
+func newTestTUSServer(t *testing.T, onPatch func()) (*httptest.Server, *sync.Map) {
+	t.Helper()
+
+	var files sync.Map
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := strings.CutPrefix(r.URL.Path, "/api/resources"); ok && r.Method == http.MethodGet {
+			if _, ok := files.Load(p); !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"path":"` + p + `"}`))
+			return
+		}
+
+		p, ok := strings.CutPrefix(r.URL.Path, "/api/tus")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			if r.URL.Query().Get("override") == "true" {
+				files.Store(p, []byte{})
+			} else {
+				files.LoadOrStore(p, []byte{})
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead:
+			content, ok := files.Load(p)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(content.([]byte))))
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPatch:
+			if onPatch != nil {
+				onPatch()
+			}
+			content, _ := files.Load(p)
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			files.Store(p, append(content.([]byte), body...))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &files
+}
+
+func TestUploadManager(t *testing.T) {
+	t.Parallel()
+
+	srv, files := newTestTUSServer(t, nil)
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), walFileName), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, unsubscribe := writeAheadLog.Subscribe(100)
+	defer unsubscribe()
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+	for i := range paths {
+		if err := os.WriteFile(paths[i], []byte("content of "+paths[i]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	um, err := newUploadManager(writeAheadLog, &filebrowserSession{host: srv.URL},
+		func(bid, path string, err error) { t.Errorf("upload of (%v) failed: %v", path, err) },
+		func(err error) { t.Errorf("upload manager error: %v", err) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unfinished, err := um.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unfinished) != 0 {
+		t.Fatalf("expected no unfinished batches in a new WAL, got %v", len(unfinished))
+	}
+
+	if err := um.BeginUpload("/remote", paths, wal.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for done := false; !done; {
+		select {
+		case ev := <-events:
+			done = ev.Type == wal.BatchRemoved
+		case <-timeout:
+			t.Fatal("timed out waiting for the batch to finish")
+		}
+	}
+
+	if err := um.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range paths {
+		content, ok := files.Load("/remote/" + filepath.Base(paths[i]))
+		if !ok {
+			t.Fatalf("(%v) was not uploaded", paths[i])
+		}
+
+		if string(content.([]byte)) != "content of "+paths[i] {
+			t.Fatalf("unexpected content uploaded for (%v): %q", paths[i], content)
+		}
+	}
+
+	history, err := writeAheadLog.History(wal.HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 1 || history[0].Files != 2 || history[0].Failures != 0 {
+		t.Fatalf("unexpected history after upload: %+v", history)
+	}
+}
+
+func TestUploadManagerDrain(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	srv, files := newTestTUSServer(t, func() { <-release })
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), walFileName), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	paths := make([]string, defaultUploadSlots+2)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, strconv.Itoa(i))
+		if err := os.WriteFile(paths[i], []byte(paths[i]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	um, err := newUploadManager(writeAheadLog, &filebrowserSession{host: srv.URL},
+		func(bid, path string, err error) { t.Errorf("upload of (%v) failed: %v", path, err) },
+		func(err error) { t.Errorf("upload manager error: %v", err) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := um.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := um.BeginUpload("/remote", paths, wal.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(um.Active()) != defaultUploadSlots {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for (%v) active uploads, have (%v)", defaultUploadSlots, len(um.Active()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := make(chan error)
+	go func() { drained <- um.Drain(context.Background()) }()
+
+	// let the active uploads finish once Drain has started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for Drain")
+	}
+
+	uploaded := 0
+	files.Range(func(_, _ any) bool {
+		uploaded++
+		return true
+	})
+	if uploaded != defaultUploadSlots {
+		t.Fatalf("expected (%v) files to finish uploading, got (%v)", defaultUploadSlots, uploaded)
+	}
+
+	var unfinished int
+	for batch, err := range writeAheadLog.Batches() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for item, err := range batch.UnfinishedItems() {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if item.State != wal.StatePending {
+				t.Fatalf("expected (%v) to be left pending, got (%v)", item.LocalPath, item.State)
+			}
+			unfinished++
+		}
+	}
+
+	if unfinished != len(paths)-defaultUploadSlots {
+		t.Fatalf("expected (%v) unfinished items, got (%v)", len(paths)-defaultUploadSlots, unfinished)
+	}
+}
+
+func TestNewBatchItems(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, p := range []string{"photos/a.jpg", "photos/2024/b.jpg", "single.txt"} {
+		local := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(local), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(local, []byte(p), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var remote []string
+	for _, p := range []string{filepath.Join(dir, "photos"), filepath.Join(dir, "single.txt")} {
+		items, err := newBatchItems("/dest", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range items {
+			if items[i].Size == 0 || items[i].State != wal.StatePending {
+				t.Fatalf("unexpected item %+v", items[i])
+			}
+			remote = append(remote, items[i].RemotePath)
+		}
+	}
+
+	slices.Sort(remote)
+	want := []string{"/dest/photos/2024/b.jpg", "/dest/photos/a.jpg", "/dest/single.txt"}
+	if !slices.Equal(remote, want) {
+		t.Fatalf("expected remote paths %v, got %v", want, remote)
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"/a/photo.jpg", 0, "/a/photo.jpg"},
+		{"/a/photo.jpg", 2, "/a/photo (2).jpg"},
+		{"/a/archive.tar.gz", 1, "/a/archive.tar (1).gz"},
+		{"/a/.bashrc", 1, "/a/.bashrc (1)"},
+		{"/a/README", 3, "/a/README (3)"},
+	}
+
+	for _, test := range tests {
+		if got := conflictName(test.in, test.n); got != test.want {
+			t.Errorf("conflictName(%v, %v) = %v, want %v", test.in, test.n, got, test.want)
+		}
+	}
+}
+
+func TestUploadManagerConflictPolicies(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range wal.ConflictPolicies {
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			srv, files := newTestTUSServer(t, nil)
+			files.Store("/remote/a.txt", []byte("existing"))
+
+			db, err := bbolt.Open(filepath.Join(t.TempDir(), walFileName), 0o600, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			writeAheadLog, err := wal.NewWriteAheadLog(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			events, unsubscribe := writeAheadLog.Subscribe(100)
+			defer unsubscribe()
+
+			local := filepath.Join(t.TempDir(), "a.txt")
+			if err := os.WriteFile(local, []byte("new"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			um, err := newUploadManager(writeAheadLog, &filebrowserSession{host: srv.URL},
+				func(bid, path string, err error) { t.Errorf("upload of (%v) failed: %v", path, err) },
+				func(err error) { t.Errorf("upload manager error: %v", err) },
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := um.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := um.BeginUpload("/remote", []string{local}, policy); err != nil {
+				t.Fatal(err)
+			}
+
+			timeout := time.After(10 * time.Second)
+			for done := false; !done; {
+				select {
+				case ev := <-events:
+					done = ev.Type == wal.BatchRemoved
+				case <-timeout:
+					t.Fatal("timed out waiting for the batch to finish")
+				}
+			}
+
+			if err := um.Stop(); err != nil {
+				t.Fatal(err)
+			}
+
+			existing, _ := files.Load("/remote/a.txt")
+			renamed, hasRenamed := files.Load("/remote/a (1).txt")
+
+			switch policy {
+			case wal.ConflictOverwrite:
+				if string(existing.([]byte)) != "new" || hasRenamed {
+					t.Fatalf("expected the existing file to be replaced, got (%s), renamed (%v)", existing, hasRenamed)
+				}
+			case wal.ConflictSkip:
+				if string(existing.([]byte)) != "existing" || hasRenamed {
+					t.Fatalf("expected the existing file to be left alone, got (%s), renamed (%v)", existing, hasRenamed)
+				}
+			case wal.ConflictRename:
+				if string(existing.([]byte)) != "existing" || !hasRenamed || string(renamed.([]byte)) != "new" {
+					t.Fatalf("expected the upload next to the existing file, got (%s) and (%s)", existing, renamed)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadManagerPauseRetryCancel(t *testing.T) {
+	t.Parallel()
+
+	var blocked atomic.Bool
+	blocked.Store(true)
+	release := make(chan struct{})
+	unblock := sync.OnceFunc(func() { close(release) })
+
+	srv, files := newTestTUSServer(t, func() {
+		if blocked.Load() {
+			<-release
+		}
+	})
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), walFileName), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, unsubscribe := writeAheadLog.Subscribe(100)
+	defer unsubscribe()
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "paused"), filepath.Join(dir, "cancelled")}
+	for i := range paths {
+		if err := os.WriteFile(paths[i], []byte(paths[i]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	um, err := newUploadManager(writeAheadLog, &filebrowserSession{host: srv.URL},
+		func(bid, path string, err error) { t.Errorf("upload of (%v) failed: %v", path, err) },
+		func(err error) { t.Errorf("upload manager error: %v", err) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer um.Stop()
+	// a failing test must not leave the upload blocked, Stop would wait for it forever
+	defer unblock()
+
+	if _, err := um.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := um.BeginUpload("/remote", paths, wal.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(um.Active()) != len(paths) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for (%v) active uploads, have (%v)", len(paths), len(um.Active()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	bid := um.Active()[0].BatchID
+
+	if err := um.Pause(bid, paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := um.Cancel(bid, paths[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(typ wal.EventType, localPath string) {
+		t.Helper()
+
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type == typ && (localPath == "" || ev.Item.LocalPath == localPath) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v of (%v)", typ, localPath)
+			}
+		}
+	}
+
+	waitFor(wal.ItemRemoved, paths[1])
+
+	batch, err := um.batch(bid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline = time.Now().Add(10 * time.Second)
+	for {
+		item, err := batch.Item(paths[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.State == wal.StatePaused {
+			// the file was read, but the server never stored the blocked PATCH
+			if item.BytesConfirmed != 0 {
+				t.Fatalf("expected no confirmed bytes of the paused item, got (%v)", item.BytesConfirmed)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for (%v) to be paused, it is (%v)", paths[0], item.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	blocked.Store(false)
+	unblock()
+
+	if err := um.Retry(bid, paths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(wal.BatchRemoved, "")
+
+	content, ok := files.Load("/remote/paused")
+	if !ok || string(content.([]byte)) != paths[0] {
+		t.Fatalf("expected the retried upload to finish, got (%s)", content)
+	}
+
+	history, err := writeAheadLog.History(wal.HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cancelled file is neither finished nor unfinished
+	if len(history) != 1 || history[0].Files != 1 || history[0].Unfinished != 0 {
+		t.Fatalf("expected only the retried file in the history, got %+v", history)
+	}
+}
+
+func TestUploadManagerPermissions(t *testing.T) {
+	t.Parallel()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), walFileName), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess := &filebrowserSession{host: "http://127.0.0.1:1"}
+	um, err := newUploadManager(writeAheadLog, sess, func(string, string, error) {}, func(error) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{filepath.Join(t.TempDir(), "a.txt")}
+
+	sess.setToken(testToken(`{"user":{"perm":{"create":false,"modify":true}}}`))
+	if err = um.BeginUpload("/remote", paths, wal.ConflictRename); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected uploading without the create permission to be denied, got (%v)", err)
+	}
+
+	sess.setToken(testToken(`{"user":{"perm":{"create":true,"modify":false}}}`))
+	if err = um.BeginUpload("/remote", paths, wal.ConflictOverwrite); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected overwriting without the modify permission to be denied, got (%v)", err)
+	}
+
+	for batch, err := range writeAheadLog.Batches() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatalf("expected denied uploads to not be recorded, got batch (%v)", batch.ID())
+	}
+
+	batch, err := writeAheadLog.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.SetConflictPolicy(wal.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = um.Resume([]wal.Batch{batch}); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected resuming an overwriting batch without the modify permission to be denied, got (%v)", err)
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ctII/filebrowserui/wal"
+	"go.etcd.io/bbolt"
+)
+
+// walCommandFlags for the wal-* commands, with the flags locating the WAL database already defined.
+// dbPath must be called after parsing.
+func walCommandFlags(name string) (flags *flag.FlagSet, dbPath func() string) {
+	flags = flag.NewFlagSet(name, flag.ContinueOnError)
+
+	defaultConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		defaultConfigDir = "."
+	}
+
+	configDir := flags.String("configDir", defaultConfigDir, "path to configuration directory for filebrowser")
+	db := flags.String("db", "", "path to the WAL database, defaults to "+walFileName+" in the configuration directory")
+
+	return flags, func() string {
+		if *db != "" {
+			return *db
+		}
+		return filepath.Join(*configDir, "filebrowserui", walFileName)
+	}
+}
+
+// openWALFile at path for a wal-* command, creating it if create is true instead of returning an error.
+func openWALFile(path string, readOnly, create bool) (*bbolt.DB, error) {
+	if create {
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			return nil, fmt.Errorf("could not create directory for WAL database: %w", err)
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("could not stat WAL database: %w", err)
+	}
+
+	// the timeout stops us from waiting forever on the lock of a running filebrowserui
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("could not open WAL database (%v), is filebrowserui running?: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// RunWALCheck is the "wal-check" command, validating (and optionally repairing) the upload WAL database
+// without starting the GUI. Exits with an error if problems were found and left unrepaired.
+func RunWALCheck(args []string) error {
+	flags, dbPath := walCommandFlags("wal-check")
+	repair := flags.Bool("repair", false, "repair problems that are found")
+	quarantine := flags.Bool("quarantine", true, "when repairing, move broken batches into the quarantine bucket instead of deleting them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return checkWALFile(os.Stdout, dbPath(), *repair, wal.RepairOptions{Quarantine: *quarantine})
+}
+
+// checkWALFile at path, writing the report to out.
+func checkWALFile(out io.Writer, path string, repair bool, opts wal.RepairOptions) (err error) {
+	db, err := openWALFile(path, !repair, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close WAL database: %w", err2))
+		}
+	}()
+
+	var report wal.Report
+	if repair {
+		report, err = wal.Repair(db, opts)
+	} else {
+		report, err = wal.Check(db)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%v: version %v, %v batches, %v items, %v history entries\n",
+		path, report.Version, report.Batches, report.Items, report.History)
+
+	for _, problem := range report.Problems {
+		fmt.Fprintln(out, problem.String())
+	}
+
+	if unrepaired := len(report.Unrepaired()); unrepaired != 0 {
+		if !repair {
+			return fmt.Errorf("found %v problems, run again with -repair to fix them", unrepaired)
+		}
+		return fmt.Errorf("%v problems could not be repaired", unrepaired)
+	}
+
+	fmt.Fprintln(out, "no problems left")
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ctII/filebrowserui/wal"
+)
+
+// RunWALExport is the "wal-export" command, writing one or every unfinished upload batch as JSON to a file or stdout.
+func RunWALExport(args []string) (err error) {
+	flags, dbPath := walCommandFlags("wal-export")
+	outPath := flags.String("o", "-", "file to write the JSON document to, - for stdout")
+	batchIDs := flags.String("batch", "", "comma separated ids of the batches to export, every batch if empty")
+	list := flags.Bool("list", false, "list the ids of the batches instead of exporting them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// opened writable as NewWriteAheadLog may have to migrate an older database before reading it
+	db, err := openWALFile(dbPath(), false, false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close WAL database: %w", err2))
+		}
+	}()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		return listBatches(os.Stdout, writeAheadLog)
+	}
+
+	batches, err := selectBatches(writeAheadLog, *batchIDs)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		f, err := os.OpenFile(*outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("could not create export file: %w", err)
+		}
+		defer func() {
+			if err2 := f.Close(); err2 != nil {
+				err = errors.Join(err, fmt.Errorf("could not close export file: %w", err2))
+			}
+		}()
+		out = f
+	}
+
+	return writeAheadLog.Export(out, batches...)
+}
+
+// listBatches of writeAheadLog to out, a line per batch starting with its id.
+func listBatches(out io.Writer, writeAheadLog *wal.WriteAheadLog) error {
+	for batch, err := range writeAheadLog.Batches() {
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(out, "%v\t%v", batch.DisplayID(), describeBatches([]wal.Batch{batch})); err != nil {
+			return fmt.Errorf("could not write batch list: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// selectBatches of writeAheadLog with the comma separated ids, none if ids is empty.
+func selectBatches(writeAheadLog *wal.WriteAheadLog, ids string) ([]wal.Batch, error) {
+	if strings.TrimSpace(ids) == "" {
+		return nil, nil
+	}
+
+	wanted := make(map[string]bool)
+	for id := range strings.SplitSeq(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			wanted[id] = false
+		}
+	}
+
+	var selected []wal.Batch
+	for batch, err := range writeAheadLog.Batches() {
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := wanted[batch.DisplayID()]; ok {
+			wanted[batch.DisplayID()] = true
+			selected = append(selected, batch)
+		}
+	}
+
+	for id, found := range wanted {
+		if !found {
+			return nil, fmt.Errorf("batch (%v) not found, see \"filebrowserui wal-export -list\"", id)
+		}
+	}
+
+	return selected, nil
+}
+
+// RunWALImport is the "wal-import" command, adding the batches of a JSON document made by wal-export to the WAL.
+// They are resumed the next time filebrowserui starts.
+func RunWALImport(args []string) (err error) {
+	flags, dbPath := walCommandFlags("wal-import")
+	from := flags.String("from", "", "local root of the paths in the document to replace")
+	to := flags.String("to", "", "local root on this machine that replaces -from")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("wal-import takes exactly one document to import, - for stdin")
+	}
+
+	var in io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("could not open document to import: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	db, err := openWALFile(dbPath(), false, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := db.Close(); err2 != nil {
+			err = errors.Join(err, fmt.Errorf("could not close WAL database: %w", err2))
+		}
+	}()
+
+	writeAheadLog, err := wal.NewWriteAheadLog(db)
+	if err != nil {
+		return err
+	}
+
+	batches, err := writeAheadLog.Import(in, wal.PathRemap{From: *from, To: *to})
+	if err != nil {
+		return fmt.Errorf("nothing was imported: %w", err)
+	}
+
+	fmt.Printf("imported %v batches\n", len(batches))
+
+	return nil
+}
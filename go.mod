@@ -5,8 +5,8 @@ go 1.25.0
 require (
 	fyne.io/fyne/v2 v2.6.1
 	github.com/simplylib/errgroup v0.0.6
-	github.com/simplylib/genericsync v0.0.3
 	go.etcd.io/bbolt v1.4.1
+	golang.org/x/sys v0.45.0
 )
 
 require (
@@ -39,7 +39,6 @@ require (
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/image v0.41.0 // indirect
 	golang.org/x/net v0.55.0 // indirect
-	golang.org/x/sys v0.45.0 // indirect
 	golang.org/x/text v0.37.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -8,7 +8,21 @@ import (
 )
 
 func main() {
-	if err := cmd.Run(); err != nil {
+	run := cmd.Run
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "wal-check":
+			run = func() error { return cmd.RunWALCheck(os.Args[2:]) }
+		case "wal-export":
+			run = func() error { return cmd.RunWALExport(os.Args[2:]) }
+		case "wal-import":
+			run = func() error { return cmd.RunWALImport(os.Args[2:]) }
+		case "install-send-to":
+			run = func() error { return cmd.RunInstallSendTo(os.Args[2:]) }
+		}
+	}
+
+	if err := run(); err != nil {
 		log.SetOutput(os.Stderr)
 		log.Fatal(err)
 	}
@@ -1,40 +1,56 @@
 package wal
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
 
 type Batch struct {
-	id []byte
-	db *bbolt.DB
+	id  []byte
+	db  *bbolt.DB
+	wal *WriteAheadLog
 }
 
-func newBatch(bid []byte, db *bbolt.DB) Batch {
+func newBatch(bid []byte, w *WriteAheadLog) Batch {
 	return Batch{
-		id: bid,
-		db: db,
+		id:  bid,
+		db:  w.db,
+		wal: w,
 	}
 }
 
-func (b *Batch) Start(name string) (err error) {
+// Start name in the batch as a pending item with no other information recorded.
+func (b *Batch) Start(name string) error {
+	return b.StartItem(Item{LocalPath: name})
+}
+
+// StartItem records item as part of the batch, keyed by item.LocalPath, replacing any existing record for that path.
+func (b *Batch) StartItem(item Item) error {
+	now := time.Now()
+	if item.Created.IsZero() {
+		item.Created = now
+	}
+	item.Updated = now
+
+	value, err := encodeItem(item)
+	if err != nil {
+		return err
+	}
+
 	err = b.db.Update(func(tx *bbolt.Tx) error {
-		batchesBucket := tx.Bucket([]byte("batches"))
-		if batchesBucket == nil {
-			return errors.New("batches bucket doesn't exist, when it should at this point in the program flow. Likely database corruption or a bug")
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
 		}
 
-		bucket := batchesBucket.Bucket(b.id)
-		if bucket == nil {
-			return fmt.Errorf("WAL: bucket of Batch(%v) doesn't exist, either some corruption or more likely this was called after bucket was deleted", b.id)
+		if err := items.Put([]byte(item.LocalPath), value); err != nil {
+			return fmt.Errorf("could not add key (%v) to the items bucket: %w", item.LocalPath, err)
 		}
 
-		if err := bucket.Put([]byte(name), []byte{}); err != nil {
-			return fmt.Errorf("could not add key (%v) to the batches bucket: %w", name, err)
-		}
+		tx.OnCommit(func() { b.wal.publish(Event{Type: ItemStarted, BatchID: b.ID(), Item: item}) })
 
 		return nil
 	})
@@ -45,22 +61,210 @@ func (b *Batch) Start(name string) (err error) {
 	return nil
 }
 
+// Item recorded for name in the batch, returning ErrItemNotFound if it was never started or is already finished.
+func (b *Batch) Item(name string) (Item, error) {
+	var item Item
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		value := items.Get([]byte(name))
+		if value == nil {
+			return ErrItemNotFound
+		}
+
+		item, err = decodeItem([]byte(name), value)
+		return err
+	})
+	if err != nil {
+		return Item{}, fmt.Errorf("could not view bbolt db to get item (%v): %w", name, err)
+	}
+
+	return item, nil
+}
+
+// UpdateItem name by calling update with the current record inside a single transaction.
+// If update returns an error nothing is written and the error is returned.
+func (b *Batch) UpdateItem(name string, update func(item *Item) error) error {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		value := items.Get([]byte(name))
+		if value == nil {
+			return ErrItemNotFound
+		}
+
+		item, err := decodeItem([]byte(name), value)
+		if err != nil {
+			return err
+		}
+
+		previousState := item.State
+
+		if err := update(&item); err != nil {
+			return err
+		}
+
+		if item.State == StateFailed && previousState != StateFailed {
+			meta, err := metaBucket(tx, b.id)
+			if err != nil {
+				return err
+			}
+
+			if err := addCounter(meta, "failures", 1); err != nil {
+				return err
+			}
+		}
+
+		// the key can't be changed by the update, it would orphan the old record
+		item.LocalPath = name
+		item.Updated = time.Now()
+
+		value, err = encodeItem(item)
+		if err != nil {
+			return err
+		}
+
+		if err := items.Put([]byte(name), value); err != nil {
+			return fmt.Errorf("could not update key (%v) in the items bucket: %w", name, err)
+		}
+
+		ev := Event{Type: ItemUpdated, BatchID: b.ID(), Item: item}
+		if item.State == StateFailed && previousState != StateFailed {
+			ev.Type = ItemFailed
+		}
+		tx.OnCommit(func() { b.wal.publish(ev) })
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update item (%v) in bbolt database: %w", name, err)
+	}
+
+	return nil
+}
+
+// Items in the batch, this will give a snapshot of the records of every unfinished item.
+func (b *Batch) Items() ([]Item, error) {
+	var list []Item
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		list = make([]Item, 0, items.Stats().KeyN)
+
+		return items.ForEach(func(k, v []byte) error {
+			item, err := decodeItem(k, v)
+			if err != nil {
+				return err
+			}
+
+			list = append(list, item)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not view bbolt db to list items in bucket (%v): %w", string(b.id), err)
+	}
+
+	return list, nil
+}
+
+// Finish name by removing it from the batch and counting it towards the batch's finished files and bytes.
+// Finishing a name that isn't in the batch does nothing.
 func (b *Batch) Finish(name string) error {
+	return b.finish(name, func(meta *bbolt.Bucket, item Item) error {
+		if err := addCounter(meta, "files", 1); err != nil {
+			return err
+		}
+		return addCounter(meta, "bytes", uint64(item.Size))
+	})
+}
+
+// Skip name by removing it from the batch and counting it towards the batch's skipped files, for files that were
+// not uploaded because they already exist on the server. Skipping a name that isn't in the batch does nothing.
+func (b *Batch) Skip(name string) error {
+	return b.finish(name, func(meta *bbolt.Bucket, _ Item) error {
+		return addCounter(meta, "skipped", 1)
+	})
+}
+
+// finish name by removing it from the batch after count updated the batch's counters for it.
+func (b *Batch) finish(name string, count func(meta *bbolt.Bucket, item Item) error) error {
 	err := b.db.Update(func(tx *bbolt.Tx) error {
-		batchesBucket := tx.Bucket([]byte("batches"))
-		if batchesBucket == nil {
-			return errors.New("batches bucket doesn't exist, when it should at this point in the program flow. Likely database corruption or a bug")
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		value := items.Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+
+		item, err := decodeItem([]byte(name), value)
+		if err != nil {
+			return err
+		}
+
+		meta, err := metaBucket(tx, b.id)
+		if err != nil {
+			return err
 		}
 
-		bucket := batchesBucket.Bucket(b.id)
-		if bucket == nil {
-			return fmt.Errorf("WAL: bucket of Batch(%v) doesn't exist, either some corruption or more likely this was called after bucket was deleted", b.id)
+		if err := count(meta, item); err != nil {
+			return err
 		}
 
-		if err := bucket.Delete([]byte(name)); err != nil {
+		if err := items.Delete([]byte(name)); err != nil {
 			return fmt.Errorf("could not delete bucket (%v) key while Finishing a batch item: %w", b.id, err)
 		}
 
+		tx.OnCommit(func() { b.wal.publish(Event{Type: ItemFinished, BatchID: b.ID(), Item: item}) })
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update bbolt database: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveItem name from the batch without counting it as finished, for uploads cancelled by the user.
+// Removing a name that isn't in the batch does nothing.
+func (b *Batch) RemoveItem(name string) error {
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		value := items.Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+
+		item, err := decodeItem([]byte(name), value)
+		if err != nil {
+			return err
+		}
+
+		if err := items.Delete([]byte(name)); err != nil {
+			return fmt.Errorf("could not delete bucket (%v) key while removing a batch item: %w", b.id, err)
+		}
+
+		tx.OnCommit(func() { b.wal.publish(Event{Type: ItemRemoved, BatchID: b.ID(), Item: item}) })
+
 		return nil
 	})
 	if err != nil {
@@ -75,23 +279,14 @@ func (b *Batch) ListUnfinished() ([]string, error) {
 	var list []string
 
 	err := b.db.View(func(tx *bbolt.Tx) error {
-		batchesBucket := tx.Bucket([]byte("batches"))
-		if batchesBucket == nil {
-			return errors.New("batches bucket doesn't exist, when it should at this point in the program flow. Likely database corruption or a bug")
-		}
-
-		bucket := batchesBucket.Bucket(b.id)
-		if bucket == nil {
-			return fmt.Errorf("WAL: bucket of Batch(%v) doesn't exist, either some corruption or more likely this was called after bucket was deleted", b.id)
+		items, err := itemsBucket(tx, b.id)
+		if err != nil {
+			return err
 		}
 
-		list = make([]string, 0, bucket.Stats().KeyN)
-
-		err := bucket.ForEach(func(k, _ []byte) error {
-			if bytes.Equal(k, []byte("dest")) {
-				return nil
-			}
+		list = make([]string, 0, items.Stats().KeyN)
 
+		err = items.ForEach(func(k, _ []byte) error {
 			list = append(list, string(k))
 			return nil
 		})
@@ -112,17 +307,12 @@ func (b *Batch) Destination() (string, error) {
 	var destination string
 
 	err := b.db.View(func(tx *bbolt.Tx) error {
-		batchesBucket := tx.Bucket([]byte("batches"))
-		if batchesBucket == nil {
-			return errors.New("batches bucket doesn't exist, when it should at this point in the program flow. Likely database corruption or a bug")
-		}
-
-		bucket := batchesBucket.Bucket(b.id)
-		if bucket == nil {
-			return fmt.Errorf("WAL: bucket of Batch(%v) doesn't exist, either some corruption or more likely this was called after bucket was deleted", b.id)
+		meta, err := metaBucket(tx, b.id)
+		if err != nil {
+			return err
 		}
 
-		dest := bucket.Get([]byte("dest"))
+		dest := meta.Get([]byte("dest"))
 		if dest == nil {
 			return errors.New("dest field is nil on a bucket that exists, bug/corruption in library?")
 		}
@@ -141,3 +331,53 @@ func (b *Batch) Destination() (string, error) {
 func (b *Batch) ID() string {
 	return string(b.id)
 }
+
+// DisplayID is the human readable form of ID, the one used by History and wal-check.
+func (b *Batch) DisplayID() string {
+	return batchIDString(b.ID())
+}
+
+// batchBucket of the batch id inside of tx, containing the "meta" and "items" buckets.
+func batchBucket(tx *bbolt.Tx, id []byte) (*bbolt.Bucket, error) {
+	batchesBucket := tx.Bucket([]byte("batches"))
+	if batchesBucket == nil {
+		return nil, errors.New("batches bucket doesn't exist, when it should at this point in the program flow. Likely database corruption or a bug")
+	}
+
+	bucket := batchesBucket.Bucket(id)
+	if bucket == nil {
+		return nil, fmt.Errorf("WAL: bucket of Batch(%v) doesn't exist, either some corruption or more likely this was called after bucket was deleted", id)
+	}
+
+	return bucket, nil
+}
+
+// metaBucket of the batch id, holding information about the batch as a whole like its destination.
+func metaBucket(tx *bbolt.Tx, id []byte) (*bbolt.Bucket, error) {
+	bucket, err := batchBucket(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := bucket.Bucket([]byte("meta"))
+	if meta == nil {
+		return nil, fmt.Errorf("WAL: meta bucket of Batch(%v) doesn't exist, likely database corruption or a bug", id)
+	}
+
+	return meta, nil
+}
+
+// itemsBucket of the batch id, holding an Item record per path.
+func itemsBucket(tx *bbolt.Tx, id []byte) (*bbolt.Bucket, error) {
+	bucket, err := batchBucket(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := bucket.Bucket([]byte("items"))
+	if items == nil {
+		return nil, fmt.Errorf("WAL: items bucket of Batch(%v) doesn't exist, likely database corruption or a bug", id)
+	}
+
+	return items, nil
+}
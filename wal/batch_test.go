@@ -1,12 +1,11 @@
 package wal
 
 import (
-	"fmt"
+	"errors"
 	"os"
-	"strconv"
 	"testing"
+	"time"
 
-	"github.com/simplylib/errgroup"
 	"go.etcd.io/bbolt"
 )
 
@@ -98,4 +97,135 @@ func TestBatch(t *testing.T) {
 	}
 }
 
+func TestBatchItems(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	batch, err := wal.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// legacy Start only records the path
+	if err = batch.Start("/tmp/legacy"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := batch.Item("/tmp/legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.LocalPath != "/tmp/legacy" || item.State != StatePending || item.Version != itemRecordVersion {
+		t.Fatalf("unexpected item from Start: %+v", item)
+	}
+
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = batch.StartItem(Item{
+		LocalPath:  "/tmp/file.txt",
+		RemotePath: "/remote/file.txt",
+		Size:       1024,
+		ModTime:    modTime,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
+	err = batch.UpdateItem("/tmp/file.txt", func(item *Item) error {
+		item.State = StateFailed
+		item.Attempts++
+		item.LastError = "connection reset"
+		item.BytesConfirmed = 512
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err = batch.Item("/tmp/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.RemotePath != "/remote/file.txt" || item.Size != 1024 || !item.ModTime.Equal(modTime) {
+		t.Fatalf("file information was not kept: %+v", item)
+	}
+
+	if item.State != StateFailed || item.Attempts != 1 || item.LastError != "connection reset" || item.BytesConfirmed != 512 {
+		t.Fatalf("update was not stored: %+v", item)
+	}
+
+	if item.Updated.Before(item.Created) {
+		t.Fatalf("updated (%v) is before created (%v)", item.Updated, item.Created)
+	}
+
+	// an erroring update must not be written
+	err = batch.UpdateItem("/tmp/file.txt", func(item *Item) error {
+		item.Attempts = 100
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("expected error from aborted update")
+	}
+
+	items, err := batch.Items()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %v", len(items))
+	}
+
+	for i := range items {
+		if items[i].Attempts == 100 {
+			t.Fatalf("aborted update was written: %+v", items[i])
+		}
+	}
+
+	if err = batch.Finish("/tmp/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = batch.Item("/tmp/file.txt"); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+
+	if err = batch.UpdateItem("/tmp/file.txt", func(*Item) error { return nil }); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("expected ErrItemNotFound, got %v", err)
+	}
+}
+
+func TestBatchItemNamedDest(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	batch, err := wal.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.Start("dest"); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := batch.Destination()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dest != "/remote" {
+		t.Fatalf("item named dest overwrote the destination: %v", dest)
+	}
+
+	unfinished, err := batch.ListUnfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unfinished) != 1 || unfinished[0] != "dest" {
+		t.Fatalf("expected [dest] to be unfinished, got %v", unfinished)
+	}
+}
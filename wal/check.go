@@ -0,0 +1,421 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Problem found in the database by Check or Repair.
+type Problem struct {
+	// BatchID of the batch the problem is in, or "" if it is not in a batch.
+	BatchID string
+	// Key of the record with the problem, if there is one.
+	Key string
+
+	Description string
+
+	// Repaired is true when Repair fixed, removed, or quarantined the problem.
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+
+	if p.BatchID != "" {
+		fmt.Fprintf(&b, "batch %v: ", batchIDString(p.BatchID))
+	}
+	if p.Key != "" {
+		fmt.Fprintf(&b, "%q: ", p.Key)
+	}
+	b.WriteString(p.Description)
+	if p.Repaired {
+		b.WriteString(" (repaired)")
+	}
+
+	return b.String()
+}
+
+// Report of the state of a WAL database.
+type Report struct {
+	Version string
+
+	Batches int
+	Items   int
+	History int
+
+	Problems []Problem
+}
+
+// OK is true when no problems were found.
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Unrepaired problems left in the database.
+func (r Report) Unrepaired() []Problem {
+	var problems []Problem
+	for i := range r.Problems {
+		if !r.Problems[i].Repaired {
+			problems = append(problems, r.Problems[i])
+		}
+	}
+	return problems
+}
+
+// RepairOptions change how Repair handles broken batches.
+type RepairOptions struct {
+	// Quarantine moves broken batches and records into the "quarantine" bucket instead of deleting them.
+	Quarantine bool
+}
+
+// Check the structure of a WAL database without modifying it.
+// An error is only returned when the database could not be read, problems are in the Report.
+func Check(db *bbolt.DB) (Report, error) {
+	var report Report
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		var err error
+		report, err = inspect(tx, nil)
+		return err
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("could not view bbolt database to check it: %w", err)
+	}
+
+	return report, nil
+}
+
+// Repair a WAL database by recreating missing buckets and removing or quarantining anything malformed,
+// so that NewWriteAheadLog can open it again. A database from a newer version is never modified.
+func Repair(db *bbolt.DB, opts RepairOptions) (Report, error) {
+	var report Report
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		report, err = inspect(tx, &opts)
+		return err
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("could not update bbolt database to repair it: %w", err)
+	}
+
+	return report, nil
+}
+
+// quarantiner moves broken records into the "quarantine" bucket, or drops them if quarantining is disabled.
+type quarantiner struct {
+	tx      *bbolt.Tx
+	enabled bool
+	prefix  string
+}
+
+// bucket for name inside of the quarantine bucket.
+func (q quarantiner) bucket(name string) (*bbolt.Bucket, error) {
+	root, err := q.tx.CreateBucketIfNotExists([]byte("quarantine"))
+	if err != nil {
+		return nil, fmt.Errorf("could not create quarantine bucket: %w", err)
+	}
+
+	b, err := root.CreateBucketIfNotExists([]byte(q.prefix + name))
+	if err != nil {
+		return nil, fmt.Errorf("could not create quarantine bucket for (%v): %w", name, err)
+	}
+
+	return b, nil
+}
+
+// moveBucket src into the quarantine under name.
+func (q quarantiner) moveBucket(name string, src *bbolt.Bucket) error {
+	if !q.enabled {
+		return nil
+	}
+
+	dst, err := q.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	return copyBucket(dst, src)
+}
+
+// moveKey k of src into the quarantine under name.
+func (q quarantiner) moveKey(name string, src *bbolt.Bucket, k []byte) error {
+	if !q.enabled {
+		return nil
+	}
+
+	dst, err := q.bucket(name)
+	if err != nil {
+		return err
+	}
+
+	if nested := src.Bucket(k); nested != nil {
+		dstNested, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return fmt.Errorf("could not create quarantine bucket for (%v): %w", string(k), err)
+		}
+		return copyBucket(dstNested, nested)
+	}
+
+	return dst.Put(k, append([]byte{}, src.Get(k)...))
+}
+
+// inspect tx for problems, repairing them if opts is not nil.
+func inspect(tx *bbolt.Tx, opts *RepairOptions) (Report, error) {
+	var report Report
+	repair := opts != nil
+
+	problem := func(batchID, key, description string) {
+		report.Problems = append(report.Problems, Problem{BatchID: batchID, Key: key, Description: description, Repaired: repair})
+	}
+
+	q := quarantiner{tx: tx, enabled: repair && opts.Quarantine, prefix: time.Now().Format(time.RFC3339Nano) + " "}
+
+	// without a valid version the layout of the batches is unknown, repairing them against this layout could destroy a
+	// database that only needs to be migrated
+	unknownVersion := func(description string) (Report, error) {
+		report.Problems = append(report.Problems, Problem{Key: "version", Description: description})
+		return report, nil
+	}
+
+	metadata := tx.Bucket([]byte("metadata"))
+	if metadata == nil {
+		return unknownVersion("metadata bucket is missing, the database version is unknown")
+	}
+
+	report.Version = string(metadata.Get([]byte("version")))
+
+	cmp, err := compareVersions(report.Version, schemaVersion)
+	switch {
+	case report.Version == "":
+		return unknownVersion("version is missing")
+	case err != nil:
+		return unknownVersion(fmt.Sprintf("version is invalid: %v", err))
+	case cmp > 0:
+		// nothing else can be trusted to be a problem, the layout may have changed
+		return unknownVersion(fmt.Sprintf("database version (%v) is newer than supported (%v)", report.Version, schemaVersion))
+	case cmp < 0:
+		// older databases are migrated by NewWriteAheadLog, checking them against this layout would find false problems
+		return report, nil
+	}
+
+	for _, name := range []string{"batches", "history"} {
+		if tx.Bucket([]byte(name)) != nil {
+			continue
+		}
+
+		problem("", "", name+" bucket is missing")
+
+		if repair {
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return report, fmt.Errorf("could not create %v bucket: %w", name, err)
+			}
+		}
+	}
+
+	if batches := tx.Bucket([]byte("batches")); batches != nil {
+		if err := inspectBatches(batches, &report, problem, repair, q); err != nil {
+			return report, err
+		}
+	}
+
+	if history := tx.Bucket([]byte("history")); history != nil {
+		var broken [][]byte
+		err := history.ForEach(func(k, v []byte) error {
+			var entry HistoryEntry
+			if v == nil || len(k) < 8 || json.Unmarshal(v, &entry) != nil {
+				problem("", string(k), "history entry is malformed")
+				broken = append(broken, append([]byte{}, k...))
+				return nil
+			}
+
+			report.History++
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("could not iterate history bucket: %w", err)
+		}
+
+		for _, k := range broken {
+			if !repair {
+				break
+			}
+
+			if err := q.moveKey("history", history, k); err != nil {
+				return report, err
+			}
+
+			if err := deleteKeyOrBucket(history, k); err != nil {
+				return report, fmt.Errorf("could not delete history entry: %w", err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func inspectBatches(batches *bbolt.Bucket, report *Report, problem func(batchID, key, description string), repair bool, q quarantiner) error {
+	var (
+		strayKeys  [][]byte
+		badBatches [][]byte
+		badCreated [][]byte
+		badPolicy  [][]byte
+
+		// badItems of each batch id
+		badItems = map[string][][]byte{}
+	)
+
+	// bbolt doesn't allow modifying buckets while iterating them, so everything is repaired afterwards
+	err := batches.ForEach(func(k, v []byte) error {
+		if v != nil {
+			problem("", string(k), "key in the batches bucket is not a batch")
+			strayKeys = append(strayKeys, append([]byte{}, k...))
+			return nil
+		}
+
+		id := string(k)
+		batch := batches.Bucket(k)
+
+		meta := batch.Bucket([]byte("meta"))
+		items := batch.Bucket([]byte("items"))
+
+		switch {
+		case meta == nil && items == nil:
+			problem(id, "", "batch is orphaned, it has no meta or items bucket")
+		case meta == nil:
+			problem(id, "", "batch has no meta bucket")
+		case items == nil:
+			problem(id, "", "batch has no items bucket")
+		case meta.Get([]byte("dest")) == nil:
+			problem(id, "dest", "batch has no destination")
+		}
+		if meta == nil || items == nil || meta.Get([]byte("dest")) == nil {
+			badBatches = append(badBatches, append([]byte{}, k...))
+			return nil
+		}
+
+		if created := meta.Get([]byte("created")); created != nil {
+			if err := (&time.Time{}).UnmarshalText(created); err != nil {
+				problem(id, "created", "creation time is malformed")
+				badCreated = append(badCreated, append([]byte{}, k...))
+			}
+		}
+
+		if policy := meta.Get([]byte("conflict")); policy != nil && !ConflictPolicy(policy).Valid() {
+			problem(id, "conflict", fmt.Sprintf("conflict policy (%v) is unknown", string(policy)))
+			badPolicy = append(badPolicy, append([]byte{}, k...))
+		}
+
+		report.Batches++
+
+		return items.ForEach(func(k, v []byte) error {
+			if v == nil {
+				problem(id, string(k), "item is a bucket instead of a record")
+				badItems[id] = append(badItems[id], append([]byte{}, k...))
+				return nil
+			}
+
+			if _, err := decodeItem(k, v); err != nil {
+				problem(id, string(k), fmt.Sprintf("item is malformed: %v", err))
+				badItems[id] = append(badItems[id], append([]byte{}, k...))
+				return nil
+			}
+
+			report.Items++
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("could not iterate batches bucket: %w", err)
+	}
+
+	if !repair {
+		return nil
+	}
+
+	for _, k := range strayKeys {
+		if err := q.moveKey("batches", batches, k); err != nil {
+			return err
+		}
+
+		if err := batches.Delete(k); err != nil {
+			return fmt.Errorf("could not delete stray key (%v) in batches bucket: %w", string(k), err)
+		}
+	}
+
+	for _, k := range badBatches {
+		if err := q.moveBucket("batch "+batchIDString(string(k)), batches.Bucket(k)); err != nil {
+			return err
+		}
+
+		if err := batches.DeleteBucket(k); err != nil {
+			return fmt.Errorf("could not delete broken batch (%v): %w", batchIDString(string(k)), err)
+		}
+	}
+
+	for _, k := range badCreated {
+		if err := batches.Bucket(k).Bucket([]byte("meta")).Delete([]byte("created")); err != nil {
+			return fmt.Errorf("could not delete malformed creation time of batch (%v): %w", batchIDString(string(k)), err)
+		}
+	}
+
+	// the intended policy is unknown, so use the only one that can't lose a file on the server
+	for _, k := range badPolicy {
+		if err := batches.Bucket(k).Bucket([]byte("meta")).Put([]byte("conflict"), []byte(ConflictRename)); err != nil {
+			return fmt.Errorf("could not replace unknown conflict policy of batch (%v): %w", batchIDString(string(k)), err)
+		}
+	}
+
+	for id, keys := range badItems {
+		items := batches.Bucket([]byte(id)).Bucket([]byte("items"))
+
+		for _, k := range keys {
+			if err := q.moveKey("items of batch "+batchIDString(id), items, k); err != nil {
+				return err
+			}
+
+			if err := deleteKeyOrBucket(items, k); err != nil {
+				return fmt.Errorf("could not delete broken item (%v) of batch (%v): %w", string(k), batchIDString(id), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyBucket recursively from src into dst.
+func copyBucket(dst, src *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(append([]byte{}, k...), append([]byte{}, v...))
+		}
+
+		nested, err := dst.CreateBucket(append([]byte{}, k...))
+		if err != nil {
+			return fmt.Errorf("could not create nested bucket (%v): %w", string(k), err)
+		}
+
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+func deleteKeyOrBucket(b *bbolt.Bucket, k []byte) error {
+	if b.Bucket(k) != nil {
+		return b.DeleteBucket(k)
+	}
+	return b.Delete(k)
+}
+
+// batchIDString is a human readable form of a Batch.ID.
+func batchIDString(id string) string {
+	n, size := binary.Uvarint([]byte(id))
+	if size <= 0 || size != len(id) {
+		return fmt.Sprintf("%q", id)
+	}
+	return fmt.Sprint(n)
+}
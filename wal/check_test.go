@@ -0,0 +1,195 @@
+package wal
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestCheckAndRepair(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	good, err := wal.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = good.StartItem(Item{LocalPath: "/tmp/good"}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(wal.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() || report.Batches != 1 || report.Items != 1 {
+		t.Fatalf("expected healthy report with 1 batch and 1 item, got %+v", report)
+	}
+
+	// break the database in the ways a bad shutdown or bug might
+	err = wal.db.Update(func(tx *bbolt.Tx) error {
+		batches := tx.Bucket([]byte("batches"))
+
+		if err := batches.Put([]byte("dest"), []byte("/stray")); err != nil {
+			return err
+		}
+
+		if _, err := batches.CreateBucket([]byte{0x7f}); err != nil {
+			return err
+		}
+
+		items, err := itemsBucket(tx, good.id)
+		if err != nil {
+			return err
+		}
+
+		if err := items.Put([]byte("/tmp/malformed"), []byte("{not json")); err != nil {
+			return err
+		}
+
+		meta, err := metaBucket(tx, good.id)
+		if err != nil {
+			return err
+		}
+
+		if err := meta.Put([]byte("conflict"), []byte("merge")); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte("history")).Put([]byte("short"), []byte("{}"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Check(wal.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Problems) != 5 {
+		t.Fatalf("expected 5 problems, got %v: %v", len(report.Problems), report.Problems)
+	}
+
+	if len(report.Unrepaired()) != 5 {
+		t.Fatalf("Check must not repair anything: %v", report.Problems)
+	}
+
+	report, err = Repair(wal.db, RepairOptions{Quarantine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Problems) != 5 || len(report.Unrepaired()) != 0 {
+		t.Fatalf("expected 5 repaired problems, got %v", report.Problems)
+	}
+
+	report, err = Check(wal.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() {
+		t.Fatalf("expected no problems after repair, got %v", report.Problems)
+	}
+
+	unfinished, err := good.ListUnfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(unfinished) != 1 || unfinished[0] != "/tmp/good" {
+		t.Fatalf("repair changed a healthy batch: %v", unfinished)
+	}
+
+	if policy, err := good.ConflictPolicy(); err != nil || policy != ConflictRename {
+		t.Fatalf("expected unknown conflict policy to be repaired to (%v), got (%v, %v)", ConflictRename, policy, err)
+	}
+
+	err = wal.db.View(func(tx *bbolt.Tx) error {
+		quarantine := tx.Bucket([]byte("quarantine"))
+		if quarantine == nil {
+			t.Fatal("expected quarantine bucket after repair")
+		}
+
+		if n := quarantine.Stats().BucketN - 1; n != 4 {
+			t.Errorf("expected 4 quarantined groups, got %v", n)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewWriteAheadLog(wal.db); err != nil {
+		t.Fatalf("could not open repaired database: %v", err)
+	}
+}
+
+func TestRepairUnknownVersion(t *testing.T) {
+	t.Parallel()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "wal.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// layout written by version 0.0.1 with a garbled version
+	err = db.Update(func(tx *bbolt.Tx) error {
+		metadata, err := tx.CreateBucket([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		if err := metadata.Put([]byte("version"), []byte("0.0.\x00")); err != nil {
+			return err
+		}
+
+		batches, err := tx.CreateBucket([]byte("batches"))
+		if err != nil {
+			return err
+		}
+
+		batch, err := batches.CreateBucket([]byte{1})
+		if err != nil {
+			return err
+		}
+		if err := batch.Put([]byte("dest"), []byte("/remote")); err != nil {
+			return err
+		}
+		return batch.Put([]byte("/tmp/a"), []byte{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Repair(db, RepairOptions{Quarantine: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Problems) != 1 || len(report.Unrepaired()) != 1 {
+		t.Fatalf("expected only the unrepaired version problem, got %v", report.Problems)
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		if version := string(tx.Bucket([]byte("metadata")).Get([]byte("version"))); version != "0.0.\x00" {
+			t.Errorf("repair changed the unknown version to (%v)", version)
+		}
+
+		batch := tx.Bucket([]byte("batches")).Bucket([]byte{1})
+		if batch == nil || batch.Get([]byte("/tmp/a")) == nil {
+			t.Error("repair touched the batches of a database with an unknown version")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,80 @@
+package wal
+
+import (
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ConflictPolicy is what an uploader does when a file already exists at the RemotePath of an item.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the existing file. Batches without a policy use it.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkip leaves the existing file alone and finishes the item without uploading it.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictRename uploads next to the existing file under a new name, keeping both.
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ConflictPolicies in the order they should be offered to a user.
+var ConflictPolicies = []ConflictPolicy{ConflictRename, ConflictSkip, ConflictOverwrite}
+
+// Valid is true for the policies defined by this package.
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case ConflictOverwrite, ConflictSkip, ConflictRename:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetConflictPolicy of the batch, used by every item that has not been created on the server yet.
+func (b *Batch) SetConflictPolicy(policy ConflictPolicy) error {
+	if !policy.Valid() {
+		return fmt.Errorf("WAL: unknown conflict policy (%v)", policy)
+	}
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		meta, err := metaBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		return meta.Put([]byte("conflict"), []byte(policy))
+	})
+	if err != nil {
+		return fmt.Errorf("could not update bbolt database to set conflict policy: %w", err)
+	}
+
+	return nil
+}
+
+// ConflictPolicy of the batch, ConflictOverwrite if none was set.
+func (b *Batch) ConflictPolicy() (ConflictPolicy, error) {
+	policy := ConflictOverwrite
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		meta, err := metaBucket(tx, b.id)
+		if err != nil {
+			return err
+		}
+
+		if stored := meta.Get([]byte("conflict")); stored != nil {
+			policy = ConflictPolicy(stored)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not view bbolt database to get conflict policy: %w", err)
+	}
+
+	if !policy.Valid() {
+		return "", fmt.Errorf("WAL: batch (%v) has unknown conflict policy (%v)", batchIDString(b.ID()), policy)
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,42 @@
+package wal
+
+import "testing"
+
+func TestConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	w := newTestWAL(t)
+
+	batch, err := w.NewBatch("/dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := batch.ConflictPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy != ConflictOverwrite {
+		t.Fatalf("expected batches without a policy to use (%v), got (%v)", ConflictOverwrite, policy)
+	}
+
+	for _, want := range ConflictPolicies {
+		if err := batch.SetConflictPolicy(want); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err := batch.ConflictPolicy()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if policy != want {
+			t.Fatalf("expected conflict policy (%v), got (%v)", want, policy)
+		}
+	}
+
+	if err := batch.SetConflictPolicy("merge"); err == nil {
+		t.Fatal("expected an error setting an unknown conflict policy")
+	}
+}
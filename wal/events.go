@@ -0,0 +1,120 @@
+package wal
+
+import (
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// EventType is the kind of change an Event describes.
+type EventType uint8
+
+const (
+	// BatchCreated by WriteAheadLog.NewBatch.
+	BatchCreated EventType = iota
+	// ItemStarted by Batch.Start or Batch.StartItem.
+	ItemStarted
+	// ItemUpdated by Batch.UpdateItem, unless the update made it fail.
+	ItemUpdated
+	// ItemFailed when Batch.UpdateItem moved the item into StateFailed.
+	ItemFailed
+	// ItemFinished by Batch.Finish or Batch.Skip.
+	ItemFinished
+	// BatchRemoved by WriteAheadLog.RemoveBatch.
+	BatchRemoved
+	// ItemRemoved by Batch.RemoveItem.
+	ItemRemoved
+)
+
+var eventTypeNames = [...]string{
+	BatchCreated: "BatchCreated",
+	ItemStarted:  "ItemStarted",
+	ItemUpdated:  "ItemUpdated",
+	ItemFailed:   "ItemFailed",
+	ItemFinished: "ItemFinished",
+	BatchRemoved: "BatchRemoved",
+	ItemRemoved:  "ItemRemoved",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", t)
+}
+
+// Event describes a change to the WAL, sent to subscribers after the transaction making it has committed.
+type Event struct {
+	Type EventType
+
+	// BatchID is the Batch.ID of the batch that changed.
+	BatchID string
+
+	// Item is the record after the change, set for item events.
+	Item Item
+
+	// History is the summary of the batch, set for BatchRemoved.
+	History HistoryEntry
+}
+
+// subscriber of the events of a WriteAheadLog.
+type subscriber struct {
+	ch chan Event
+
+	// dropped events because ch was full
+	dropped atomic.Uint64
+}
+
+// Subscribe to events, buffering up to buffer events for the subscriber.
+// Events are dropped for a subscriber whose buffer is full instead of blocking writers to the WAL.
+// Calling unsubscribe closes the returned channel.
+func (w *WriteAheadLog) Subscribe(buffer int) (events <-chan Event, unsubscribe func()) {
+	events, _, unsubscribe = w.SubscribeCountingDrops(buffer)
+	return events, unsubscribe
+}
+
+// SubscribeCountingDrops is Subscribe, also returning the number of events dropped for the subscriber so far.
+// A subscriber that must not miss any change can reload the WAL whenever it grows.
+func (w *WriteAheadLog) SubscribeCountingDrops(buffer int) (events <-chan Event, dropped func() uint64, unsubscribe func()) {
+	sub := &subscriber{ch: make(chan Event, buffer)}
+
+	w.subscribersMu.Lock()
+	defer w.subscribersMu.Unlock()
+
+	if w.subscribers == nil {
+		w.subscribers = make(map[uint64]*subscriber)
+	}
+
+	id := w.nextSubscriber
+	w.nextSubscriber++
+	w.subscribers[id] = sub
+
+	var unsubscribed bool
+	return sub.ch, sub.dropped.Load, func() {
+		w.subscribersMu.Lock()
+		defer w.subscribersMu.Unlock()
+
+		if unsubscribed {
+			return
+		}
+		unsubscribed = true
+
+		delete(w.subscribers, id)
+		close(sub.ch)
+	}
+}
+
+// publish ev to every subscriber without blocking.
+func (w *WriteAheadLog) publish(ev Event) {
+	w.subscribersMu.RLock()
+	defer w.subscribersMu.RUnlock()
+
+	for id, sub := range w.subscribers {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped.Add(1)
+			slog.Debug("WAL subscriber buffer is full, dropping event", "subscriber", id, "event", ev.Type.String())
+		}
+	}
+}
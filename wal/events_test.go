@@ -0,0 +1,104 @@
+package wal
+
+import (
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for WAL event")
+		return Event{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	events, unsubscribe := wal.Subscribe(16)
+	defer unsubscribe()
+
+	// a subscriber that never reads must not block the WAL
+	_, dropped, unsubscribeFull := wal.SubscribeCountingDrops(0)
+	defer unsubscribeFull()
+
+	batch, err := wal.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.StartItem(Item{LocalPath: "/tmp/a", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = batch.UpdateItem("/tmp/a", func(item *Item) error {
+		item.State = StateUploading
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = batch.UpdateItem("/tmp/a", func(item *Item) error {
+		item.State = StateFailed
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.Finish("/tmp/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.StartItem(Item{LocalPath: "/tmp/a", Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.RemoveItem("/tmp/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = wal.RemoveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EventType{BatchCreated, ItemStarted, ItemUpdated, ItemFailed, ItemFinished, ItemStarted, ItemRemoved, BatchRemoved}
+
+	if dropped() != uint64(len(want)) {
+		t.Fatalf("expected every event to be dropped for the full subscriber, got (%v) of (%v)", dropped(), len(want))
+	}
+
+	for _, typ := range want {
+		ev := nextEvent(t, events)
+		if ev.Type != typ {
+			t.Fatalf("expected event %v, got %v", typ, ev.Type)
+		}
+
+		if ev.BatchID != batch.ID() {
+			t.Fatalf("expected event for batch (%v), got (%v)", batch.ID(), ev.BatchID)
+		}
+
+		if typ != BatchCreated && typ != BatchRemoved && ev.Item.LocalPath != "/tmp/a" {
+			t.Fatalf("expected item /tmp/a on %v, got %+v", typ, ev.Item)
+		}
+	}
+
+	// failed transactions don't publish
+	if err = batch.Finish("/tmp/a"); err == nil {
+		t.Fatal("expected error finishing an item in a removed batch")
+	}
+
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected no further events and a closed channel after unsubscribing")
+	}
+}
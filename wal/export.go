@@ -0,0 +1,223 @@
+package wal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// exportFormatVersion of the document written by Export.
+const exportFormatVersion = 1
+
+// ExportDocument is the portable JSON form of one or more batches.
+type ExportDocument struct {
+	Version  int             `json:"version"`
+	Exported time.Time       `json:"exported"`
+	Batches  []ExportedBatch `json:"batches"`
+}
+
+// ExportedBatch is a batch inside of an ExportDocument.
+type ExportedBatch struct {
+	Destination string         `json:"destination"`
+	Created     time.Time      `json:"created,omitzero"`
+	Conflict    ConflictPolicy `json:"conflict,omitempty"`
+	Items       []Item         `json:"items"`
+}
+
+// PathRemap replaces the local root From of every item with To when importing,
+// ex: From "C:\Users\alice\Photos" To "/home/bob/Photos". The zero value keeps paths as they are.
+type PathRemap struct {
+	From string
+	To   string
+}
+
+// apply the remap to p, comparing with forward slashes so documents can move between operating systems.
+func (r PathRemap) apply(p string) string {
+	if r.From == "" {
+		return p
+	}
+
+	from := strings.TrimSuffix(strings.ReplaceAll(r.From, `\`, "/"), "/")
+	slashed := strings.ReplaceAll(p, `\`, "/")
+
+	rest, ok := strings.CutPrefix(slashed, from)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return p
+	}
+
+	return filepath.Join(r.To, filepath.FromSlash(rest))
+}
+
+// Export batches as an ExportDocument to out, every batch in the WAL is exported if none are given.
+func (w *WriteAheadLog) Export(out io.Writer, batches ...Batch) error {
+	if len(batches) == 0 {
+		for batch, err := range w.Batches() {
+			if err != nil {
+				return err
+			}
+			batches = append(batches, batch)
+		}
+	}
+
+	doc := ExportDocument{
+		Version:  exportFormatVersion,
+		Exported: time.Now(),
+		Batches:  make([]ExportedBatch, 0, len(batches)),
+	}
+
+	for _, batch := range batches {
+		exported := ExportedBatch{Items: []Item{}}
+
+		err := w.db.View(func(tx *bbolt.Tx) error {
+			meta, err := metaBucket(tx, batch.id)
+			if err != nil {
+				return err
+			}
+
+			exported.Destination = string(meta.Get([]byte("dest")))
+
+			if created := meta.Get([]byte("created")); created != nil {
+				if err := exported.Created.UnmarshalText(created); err != nil {
+					return fmt.Errorf("could not parse created time: %w", err)
+				}
+			}
+
+			exported.Conflict = ConflictPolicy(meta.Get([]byte("conflict")))
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not view bbolt database to export batch (%v): %w", batchIDString(batch.ID()), err)
+		}
+
+		for item, err := range batch.UnfinishedItems() {
+			if err != nil {
+				return err
+			}
+			exported.Items = append(exported.Items, item)
+		}
+
+		doc.Batches = append(doc.Batches, exported)
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("could not encode export document: %w", err)
+	}
+
+	return nil
+}
+
+// Import an ExportDocument from r as new batches, applying remap to the local path of every item.
+// Items that were uploading when exported are imported as pending, since nothing is uploading them here.
+// The whole document is imported in one transaction, nothing is imported if any of it fails.
+func (w *WriteAheadLog) Import(r io.Reader, remap PathRemap) ([]Batch, error) {
+	var doc ExportDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("could not decode export document: %w", err)
+	}
+
+	if doc.Version != exportFormatVersion {
+		return nil, fmt.Errorf("unsupported export document version (%v), supported version (%v)", doc.Version, exportFormatVersion)
+	}
+
+	now := time.Now()
+	values := make([][][]byte, len(doc.Batches))
+
+	for i := range doc.Batches {
+		exported := &doc.Batches[i]
+
+		if exported.Conflict != "" && !exported.Conflict.Valid() {
+			return nil, fmt.Errorf("batch (%v) has unknown conflict policy (%v)", exported.Destination, exported.Conflict)
+		}
+
+		values[i] = make([][]byte, len(exported.Items))
+		for j := range exported.Items {
+			item := &exported.Items[j]
+
+			if item.Version > itemRecordVersion {
+				return nil, fmt.Errorf("item (%v) has record version (%v) which is newer than supported (%v)", item.LocalPath, item.Version, itemRecordVersion)
+			}
+
+			item.LocalPath = remap.apply(item.LocalPath)
+			if item.State == StateUploading {
+				item.State = StatePending
+			}
+			if item.Created.IsZero() {
+				item.Created = now
+			}
+			item.Updated = now
+
+			value, err := encodeItem(*item)
+			if err != nil {
+				return nil, err
+			}
+			values[i][j] = value
+		}
+	}
+
+	var ids [][]byte
+	err := w.db.Update(func(tx *bbolt.Tx) error {
+		ids = make([][]byte, 0, len(doc.Batches))
+
+		for i := range doc.Batches {
+			exported := &doc.Batches[i]
+
+			bid, err := createBatch(tx, exported.Destination)
+			if err != nil {
+				return err
+			}
+
+			if exported.Conflict != "" {
+				meta, err := metaBucket(tx, bid)
+				if err != nil {
+					return err
+				}
+
+				if err := meta.Put([]byte("conflict"), []byte(exported.Conflict)); err != nil {
+					return fmt.Errorf("could not set conflict policy of batch (%v): %w", exported.Destination, err)
+				}
+			}
+
+			items, err := itemsBucket(tx, bid)
+			if err != nil {
+				return err
+			}
+
+			for j := range exported.Items {
+				if err := items.Put([]byte(exported.Items[j].LocalPath), values[i][j]); err != nil {
+					return fmt.Errorf("could not add key (%v) to the items bucket: %w", exported.Items[j].LocalPath, err)
+				}
+			}
+
+			ids = append(ids, bid)
+		}
+
+		tx.OnCommit(func() {
+			for i, bid := range ids {
+				w.publish(Event{Type: BatchCreated, BatchID: string(bid)})
+				for j := range doc.Batches[i].Items {
+					w.publish(Event{Type: ItemStarted, BatchID: string(bid), Item: doc.Batches[i].Items[j]})
+				}
+			}
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not update bbolt database to import batches: %w", err)
+	}
+
+	imported := make([]Batch, 0, len(ids))
+	for _, bid := range ids {
+		imported = append(imported, newBatch(bid, w))
+	}
+
+	return imported, nil
+}
@@ -0,0 +1,158 @@
+package wal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	src := newTestWAL(t)
+
+	batch, err := src.NewBatch("/remote/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = batch.StartMany([]Item{
+		{LocalPath: "/home/alice/photos/a.jpg", RemotePath: "/remote/photos/a.jpg", Size: 10, State: StateUploading, BytesConfirmed: 5},
+		{LocalPath: "/home/alice/photos/b.jpg", RemotePath: "/remote/photos/b.jpg", Size: 20, State: StateFailed, LastError: "timeout"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = batch.SetConflictPolicy(ConflictSkip); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = src.NewBatch("/remote/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = src.Export(&buf, batch); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestWAL(t)
+
+	imported, err := dst.Import(bytes.NewReader(buf.Bytes()), PathRemap{From: "/home/alice", To: "/home/bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported) != 1 {
+		t.Fatalf("expected only the exported batch to be imported, got %v batches", len(imported))
+	}
+
+	dest, err := imported[0].Destination()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dest != "/remote/photos" {
+		t.Fatalf("expected destination /remote/photos, got %v", dest)
+	}
+
+	policy, err := imported[0].ConflictPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy != ConflictSkip {
+		t.Fatalf("expected conflict policy (%v), got (%v)", ConflictSkip, policy)
+	}
+
+	a, err := imported[0].Item("/home/bob/photos/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.State != StatePending || a.BytesConfirmed != 5 || a.RemotePath != "/remote/photos/a.jpg" || a.Size != 10 {
+		t.Fatalf("unexpected imported item: %+v", a)
+	}
+
+	b, err := imported[0].Item("/home/bob/photos/b.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.State != StateFailed || b.LastError != "timeout" {
+		t.Fatalf("unexpected imported item: %+v", b)
+	}
+
+	// exporting everything includes the empty batch
+	buf.Reset()
+	if err = src.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err = newTestWAL(t).Import(&buf, PathRemap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported) != 2 {
+		t.Fatalf("expected 2 imported batches, got %v", len(imported))
+	}
+}
+
+func TestImportAtomic(t *testing.T) {
+	t.Parallel()
+
+	w := newTestWAL(t)
+
+	docs := []string{
+		// the second batch is newer than supported, so the first one must not be imported either
+		`{"version": 1, "batches": [
+			{"destination": "/a", "items": [{"localPath": "/tmp/a", "v": 1}]},
+			{"destination": "/b", "items": [{"localPath": "/tmp/b", "v": 99}]}
+		]}`,
+		// bbolt refuses the empty key of the second batch after the first one was written
+		`{"version": 1, "batches": [
+			{"destination": "/a", "items": [{"localPath": "/tmp/a", "v": 1}]},
+			{"destination": "/b", "items": [{"localPath": "", "v": 1}]}
+		]}`,
+	}
+
+	for _, doc := range docs {
+		if _, err := w.Import(strings.NewReader(doc), PathRemap{}); err == nil {
+			t.Fatalf("expected an error importing %v", doc)
+		}
+
+		batches, err := w.ListBatches()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(batches) != 0 {
+			t.Fatalf("expected nothing to be imported from %v, got %v batches", doc, len(batches))
+		}
+	}
+}
+
+func TestPathRemap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		remap PathRemap
+		in    string
+		want  string
+	}{
+		{PathRemap{}, "/a/b", "/a/b"},
+		{PathRemap{From: "/a", To: "/c"}, "/a/b", "/c/b"},
+		{PathRemap{From: "/a/", To: "/c"}, "/a/b/d", "/c/b/d"},
+		{PathRemap{From: "/a", To: "/c"}, "/ab/d", "/ab/d"},
+		{PathRemap{From: "/a", To: "/c"}, "/x/a/d", "/x/a/d"},
+		{PathRemap{From: `C:\Users\alice`, To: "/home/bob"}, `C:\Users\alice\Photos\a.jpg`, "/home/bob/Photos/a.jpg"},
+	}
+
+	for _, test := range tests {
+		if got := test.remap.apply(test.in); got != test.want {
+			t.Errorf("%+v.apply(%v) = %v, want %v", test.remap, test.in, got, test.want)
+		}
+	}
+}
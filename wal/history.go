@@ -0,0 +1,242 @@
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// HistoryEntry is the summary kept for a batch after it is removed from the WAL.
+type HistoryEntry struct {
+	// ID is the human readable form of the Batch.ID of the batch, raw ids aren't valid UTF-8 once they're past 127.
+	ID          string `json:"id"`
+	Destination string `json:"destination"`
+
+	// Files and Bytes that were finished as part of the batch.
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+
+	// Skipped files already existed on the server and were not uploaded.
+	Skipped int `json:"skipped"`
+
+	// Failures is the number of times an item in the batch went into StateFailed.
+	Failures int `json:"failures"`
+
+	// Unfinished items were still in the batch when it was removed, meaning it was cancelled.
+	Unfinished int `json:"unfinished"`
+
+	Created  time.Time     `json:"created"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"duration"`
+}
+
+// HistoryFilter selects which entries History returns, the zero value returns everything.
+type HistoryFilter struct {
+	// Since and Until limit entries to those finished inside of the range, zero values are unbounded.
+	Since time.Time
+	Until time.Time
+
+	// Destination only returns entries whose destination starts with it.
+	Destination string
+
+	// FailedOnly returns entries that had failures or unfinished items.
+	FailedOnly bool
+
+	// Limit the number of entries returned, 0 is unlimited.
+	Limit int
+}
+
+func (f HistoryFilter) match(entry HistoryEntry) bool {
+	if !f.Since.IsZero() && entry.Finished.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && entry.Finished.After(f.Until) {
+		return false
+	}
+
+	if !strings.HasPrefix(entry.Destination, f.Destination) {
+		return false
+	}
+
+	if f.FailedOnly && entry.Failures == 0 && entry.Unfinished == 0 {
+		return false
+	}
+
+	return true
+}
+
+// Retention of history entries, entries are removed when they break either limit. Zero values disable that limit.
+type Retention struct {
+	MaxAge     time.Duration
+	MaxEntries int
+}
+
+// historyKey orders entries by the time they finished, with the batch id to keep keys unique as ids are reused.
+func historyKey(finished time.Time, id []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(finished.UnixNano())), id...)
+}
+
+// historyKeyTime is the time a history entry finished, encoded in its key.
+func historyKeyTime(k []byte) time.Time {
+	if len(k) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))
+}
+
+// getCounter from the batch meta bucket, a missing counter is 0.
+func getCounter(meta *bbolt.Bucket, key string) uint64 {
+	v := meta.Get([]byte(key))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// addCounter to the batch meta bucket.
+func addCounter(meta *bbolt.Bucket, key string, n uint64) error {
+	if err := meta.Put([]byte(key), binary.BigEndian.AppendUint64(nil, getCounter(meta, key)+n)); err != nil {
+		return fmt.Errorf("could not update counter (%v): %w", key, err)
+	}
+	return nil
+}
+
+// summarizeBatch id into a HistoryEntry that finished at finished.
+func summarizeBatch(tx *bbolt.Tx, id []byte, finished time.Time) (HistoryEntry, error) {
+	meta, err := metaBucket(tx, id)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	items, err := itemsBucket(tx, id)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	entry := HistoryEntry{
+		ID:          batchIDString(string(id)),
+		Destination: string(meta.Get([]byte("dest"))),
+		Files:       int(getCounter(meta, "files")),
+		Bytes:       int64(getCounter(meta, "bytes")),
+		Skipped:     int(getCounter(meta, "skipped")),
+		Failures:    int(getCounter(meta, "failures")),
+		Unfinished:  items.Stats().KeyN,
+		Finished:    finished,
+	}
+
+	if created := meta.Get([]byte("created")); created != nil {
+		if err := entry.Created.UnmarshalText(created); err != nil {
+			return HistoryEntry{}, fmt.Errorf("could not parse created time of batch (%v): %w", id, err)
+		}
+		entry.Duration = finished.Sub(entry.Created)
+	}
+
+	return entry, nil
+}
+
+// History of removed batches matching filter, newest first.
+func (w *WriteAheadLog) History(filter HistoryFilter) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+
+	err := w.db.View(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte("history"))
+		if history == nil {
+			return errors.New("WAL: history bucket doesn't exist, bug/corruption?")
+		}
+
+		c := history.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			// keys are ordered by finish time, so nothing before this can match
+			if !filter.Since.IsZero() && historyKeyTime(k).Before(filter.Since) {
+				break
+			}
+
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("could not unmarshal history entry json: %w", err)
+			}
+
+			if !filter.match(entry) {
+				continue
+			}
+
+			entries = append(entries, entry)
+
+			if filter.Limit > 0 && len(entries) == filter.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not view bbolt database to list history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CompactHistory by removing entries outside of retention, returning the number of entries removed.
+func (w *WriteAheadLog) CompactHistory(retention Retention) (removed int, err error) {
+	err = w.db.Update(func(tx *bbolt.Tx) error {
+		history := tx.Bucket([]byte("history"))
+		if history == nil {
+			return errors.New("WAL: history bucket doesn't exist, bug/corruption?")
+		}
+
+		excess := 0
+		if retention.MaxEntries > 0 {
+			excess = history.Stats().KeyN - retention.MaxEntries
+		}
+
+		var cutoff time.Time
+		if retention.MaxAge > 0 {
+			cutoff = time.Now().Add(-retention.MaxAge)
+		}
+
+		// oldest entries are first, Delete on a cursor moves it to the next key
+		c := history.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			if removed >= excess && (cutoff.IsZero() || !historyKeyTime(k).Before(cutoff)) {
+				break
+			}
+
+			if err := c.Delete(); err != nil {
+				return fmt.Errorf("could not delete history entry: %w", err)
+			}
+			removed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not update bbolt database to compact history: %w", err)
+	}
+
+	return removed, nil
+}
+
+// CompactHistoryEvery interval until ctx is done, calling onError for every failed compaction.
+func (w *WriteAheadLog) CompactHistoryEvery(ctx context.Context, interval time.Duration, retention Retention, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.CompactHistory(retention); err != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
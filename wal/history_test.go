@@ -0,0 +1,196 @@
+package wal
+
+import (
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	for _, dest := range []string{"/photos", "/music", "/photos/2024"} {
+		batch, err := wal.NewBatch(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"/tmp/a", "/tmp/b"} {
+			if err := batch.StartItem(Item{LocalPath: name, Size: 100}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := batch.Finish("/tmp/a"); err != nil {
+			t.Fatal(err)
+		}
+
+		if dest == "/music" {
+			err := batch.UpdateItem("/tmp/b", func(item *Item) error {
+				item.State = StateFailed
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else if dest == "/photos" {
+			if err := batch.Skip("/tmp/b"); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := batch.Finish("/tmp/b"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := wal.RemoveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := wal.History(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 history entries, got %v", len(entries))
+	}
+
+	// newest first
+	if entries[0].Destination != "/photos/2024" || entries[2].Destination != "/photos" {
+		t.Fatalf("history is not newest first: %+v", entries)
+	}
+
+	if entries[0].Files != 2 || entries[0].Bytes != 200 || entries[0].Failures != 0 || entries[0].Unfinished != 0 {
+		t.Fatalf("unexpected summary: %+v", entries[0])
+	}
+
+	if entries[2].Files != 1 || entries[2].Bytes != 100 || entries[2].Skipped != 1 || entries[2].Unfinished != 0 {
+		t.Fatalf("skipped files must not count as finished: %+v", entries[2])
+	}
+
+	if entries[0].Created.IsZero() || entries[0].Duration < 0 {
+		t.Fatalf("unexpected timing: %+v", entries[0])
+	}
+
+	failed, err := wal.History(HistoryFilter{FailedOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0].Destination != "/music" || failed[0].Failures != 1 || failed[0].Unfinished != 1 || failed[0].Files != 1 {
+		t.Fatalf("unexpected failed entries: %+v", failed)
+	}
+
+	photos, err := wal.History(HistoryFilter{Destination: "/photos", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(photos) != 1 || photos[0].Destination != "/photos/2024" {
+		t.Fatalf("unexpected destination filtered entries: %+v", photos)
+	}
+
+	future, err := wal.History(HistoryFilter{Since: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(future) != 0 {
+		t.Fatalf("expected no entries in the future, got %+v", future)
+	}
+}
+
+func TestCompactHistory(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	for range 5 {
+		batch, err := wal.NewBatch("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := wal.RemoveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := wal.CompactHistory(Retention{MaxEntries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 2 {
+		t.Fatalf("expected 2 removed entries, got %v", removed)
+	}
+
+	removed, err = wal.CompactHistory(Retention{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 0 {
+		t.Fatalf("expected no entries older than an hour, got %v removed", removed)
+	}
+
+	removed, err = wal.CompactHistory(Retention{MaxAge: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 3 {
+		t.Fatalf("expected every entry to be removed, got %v removed", removed)
+	}
+
+	entries, err := wal.History(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected empty history, got %+v", entries)
+	}
+}
+
+func TestHistoryID(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	// ids from 128 on take more than a byte, which isn't valid UTF-8 as is
+	err := wal.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("batches")).SetSequence(199)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := wal.NewBatch("/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := wal.Subscribe(8)
+	defer cancel()
+
+	if err := wal.RemoveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := wal.History(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].ID != "200" {
+		t.Fatalf("expected the history entry of batch 200, got %+v", entries)
+	}
+
+	if ev := <-events; ev.Type != BatchRemoved || ev.BatchID != batch.ID() || ev.History.ID != "200" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+}
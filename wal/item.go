@@ -0,0 +1,121 @@
+package wal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// itemRecordVersion is the version of the Item record written by this package.
+// Records written before Items existed are stored as an empty value and are read as version 0.
+const itemRecordVersion = 1
+
+// ErrItemNotFound is returned when an item is not part of a Batch.
+var ErrItemNotFound = errors.New("WAL: item not found in batch")
+
+// ItemState is where an Item is in its upload lifecycle.
+type ItemState uint8
+
+const (
+	// StatePending has not been picked up by an uploader yet.
+	StatePending ItemState = iota
+	// StateUploading is currently being sent to the server.
+	StateUploading
+	// StatePaused was stopped by the user and should not be resumed automatically.
+	StatePaused
+	// StateFailed stopped because of an error, see Item.LastError.
+	StateFailed
+)
+
+var itemStateNames = [...]string{
+	StatePending:   "pending",
+	StateUploading: "uploading",
+	StatePaused:    "paused",
+	StateFailed:    "failed",
+}
+
+func (s ItemState) String() string {
+	if int(s) < len(itemStateNames) {
+		return itemStateNames[s]
+	}
+	return fmt.Sprintf("ItemState(%d)", s)
+}
+
+func (s ItemState) MarshalText() ([]byte, error) {
+	if int(s) >= len(itemStateNames) {
+		return nil, fmt.Errorf("WAL: unknown item state (%d)", s)
+	}
+	return []byte(itemStateNames[s]), nil
+}
+
+func (s *ItemState) UnmarshalText(b []byte) error {
+	for i := range itemStateNames {
+		if itemStateNames[i] == string(b) {
+			*s = ItemState(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("WAL: unknown item state (%v)", string(b))
+}
+
+// Item is the record stored for every path in a Batch.
+type Item struct {
+	// Version of the record, set by the WAL when writing.
+	Version int `json:"v"`
+
+	// LocalPath is the absolute path of the file on this machine, it is also the key of the item in the batch.
+	LocalPath string `json:"localPath"`
+	// RemotePath is the full path the file is uploaded to on the filebrowser server.
+	RemotePath string `json:"remotePath"`
+
+	// Size and ModTime of the local file when it was added to the batch.
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+
+	State     ItemState `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+
+	// BytesConfirmed is the number of bytes the server has acknowledged receiving.
+	BytesConfirmed int64 `json:"bytesConfirmed"`
+
+	// RemoteCreated is true once the file at RemotePath was created by this upload, after the conflict policy of the
+	// batch was applied. Later attempts resume that file instead of applying the policy again.
+	RemoteCreated bool `json:"remoteCreated,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+func encodeItem(item Item) ([]byte, error) {
+	item.Version = itemRecordVersion
+
+	bs, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal item (%v) to json: %w", item.LocalPath, err)
+	}
+
+	return bs, nil
+}
+
+// decodeItem stored under key, upgrading records from older versions.
+func decodeItem(key, value []byte) (Item, error) {
+	// version 0: only the key existed, with an empty value
+	if len(value) == 0 {
+		return Item{LocalPath: string(key), State: StatePending}, nil
+	}
+
+	var item Item
+	if err := json.Unmarshal(value, &item); err != nil {
+		return Item{}, fmt.Errorf("could not unmarshal item (%v) json: %w", string(key), err)
+	}
+
+	if item.Version > itemRecordVersion {
+		return Item{}, fmt.Errorf("item (%v) has record version (%v) which is newer than supported (%v)", string(key), item.Version, itemRecordVersion)
+	}
+
+	item.LocalPath = string(key)
+
+	return item, nil
+}
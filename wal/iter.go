@@ -0,0 +1,179 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// startManyChunk is the number of items StartMany writes per transaction.
+	startManyChunk = 10_000
+
+	// iterPageSize is the number of records read per transaction by the iterators.
+	iterPageSize = 1_000
+)
+
+// StartMany records items as part of the batch like StartItem, writing them in large transactions
+// instead of one transaction per item. Items written by earlier transactions are kept if a later one fails.
+func (b *Batch) StartMany(items []Item) error {
+	for start := 0; start < len(items); start += startManyChunk {
+		chunk := items[start:min(start+startManyChunk, len(items))]
+
+		now := time.Now()
+		values := make([][]byte, len(chunk))
+		for i := range chunk {
+			if chunk[i].Created.IsZero() {
+				chunk[i].Created = now
+			}
+			chunk[i].Updated = now
+
+			value, err := encodeItem(chunk[i])
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+
+		err := b.db.Update(func(tx *bbolt.Tx) error {
+			bucket, err := itemsBucket(tx, b.id)
+			if err != nil {
+				return err
+			}
+
+			for i := range chunk {
+				if err := bucket.Put([]byte(chunk[i].LocalPath), values[i]); err != nil {
+					return fmt.Errorf("could not add key (%v) to the items bucket: %w", chunk[i].LocalPath, err)
+				}
+			}
+
+			tx.OnCommit(func() {
+				for i := range chunk {
+					b.wal.publish(Event{Type: ItemStarted, BatchID: b.ID(), Item: chunk[i]})
+				}
+			})
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not update bbolt database to start items %v to %v: %w", start, start+len(chunk), err)
+		}
+	}
+
+	return nil
+}
+
+// UnfinishedItems in the batch, read a page at a time so the whole batch is never held in memory.
+// Each page is a separate transaction, so items changed while iterating may or may not be seen.
+func (b *Batch) UnfinishedItems() iter.Seq2[Item, error] {
+	return func(yield func(Item, error) bool) {
+		var after []byte
+
+		for {
+			page := make([]Item, 0, iterPageSize)
+
+			err := b.db.View(func(tx *bbolt.Tx) error {
+				bucket, err := itemsBucket(tx, b.id)
+				if err != nil {
+					return err
+				}
+
+				c := bucket.Cursor()
+
+				k, v := c.First()
+				if after != nil {
+					k, v = c.Seek(after)
+					if k != nil && bytes.Equal(k, after) {
+						k, v = c.Next()
+					}
+				}
+
+				for ; k != nil && len(page) < iterPageSize; k, v = c.Next() {
+					item, err := decodeItem(k, v)
+					if err != nil {
+						return err
+					}
+					page = append(page, item)
+				}
+
+				return nil
+			})
+			if err != nil {
+				yield(Item{}, fmt.Errorf("could not view bbolt db to page unfinished items in bucket (%v): %w", string(b.id), err))
+				return
+			}
+
+			for i := range page {
+				if !yield(page[i], nil) {
+					return
+				}
+			}
+
+			if len(page) < iterPageSize {
+				return
+			}
+
+			after = []byte(page[len(page)-1].LocalPath)
+		}
+	}
+}
+
+// Batches currently in the WAL, read a page at a time.
+func (w *WriteAheadLog) Batches() iter.Seq2[Batch, error] {
+	return func(yield func(Batch, error) bool) {
+		var after []byte
+
+		for {
+			page := make([]Batch, 0, iterPageSize)
+
+			err := w.db.View(func(tx *bbolt.Tx) error {
+				bucket := tx.Bucket([]byte("batches"))
+				if bucket == nil {
+					return errors.New("WAL: batches bucket doesn't exist while trying to list batches, this likely means database corruption")
+				}
+
+				c := bucket.Cursor()
+
+				k, v := c.First()
+				if after != nil {
+					k, v = c.Seek(after)
+					if k != nil && bytes.Equal(k, after) {
+						k, v = c.Next()
+					}
+				}
+
+				for ; k != nil && len(page) < iterPageSize; k, v = c.Next() {
+					// only nested buckets are batches
+					if v != nil {
+						continue
+					}
+
+					// Copy ID into new byte slice, as keys are valid only in the transaction
+					page = append(page, newBatch(append([]byte{}, k...), w))
+				}
+
+				return nil
+			})
+			if err != nil {
+				yield(Batch{}, fmt.Errorf("could not view bbolt database while paging batches: %w", err))
+				return
+			}
+
+			for i := range page {
+				if !yield(page[i], nil) {
+					return
+				}
+			}
+
+			if len(page) < iterPageSize {
+				return
+			}
+
+			after = page[len(page)-1].id
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package wal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStartManyAndUnfinishedItems(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	batch, err := wal.NewBatch("/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := startManyChunk + iterPageSize + 1
+
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{LocalPath: fmt.Sprintf("/tmp/%08d", i), Size: int64(i)}
+	}
+
+	if err = batch.StartMany(items); err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	for item, err := range batch.UnfinishedItems() {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if item.LocalPath != items[i].LocalPath || item.Size != items[i].Size {
+			t.Fatalf("expected item %v to be %+v, got %+v", i, items[i], item)
+		}
+		i++
+	}
+
+	if i != n {
+		t.Fatalf("expected %v items, iterated %v", n, i)
+	}
+
+	// stopping early must not keep iterating
+	i = 0
+	for range batch.UnfinishedItems() {
+		i++
+		if i == 10 {
+			break
+		}
+	}
+
+	if i != 10 {
+		t.Fatalf("expected to stop after 10 items, got %v", i)
+	}
+}
+
+func TestBatchesIterator(t *testing.T) {
+	t.Parallel()
+
+	wal := newTestWAL(t)
+
+	for range 5 {
+		if _, err := wal.NewBatch("/remote"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// removing batches while iterating is allowed, as no transaction is held between pages
+	seen := 0
+	for batch, err := range wal.Batches() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen++
+
+		if err := wal.RemoveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if seen != 5 {
+		t.Fatalf("expected to see 5 batches, saw %v", seen)
+	}
+
+	for _, err := range wal.Batches() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("expected no batches after removing all of them")
+	}
+}
@@ -0,0 +1,234 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// schemaVersion is the layout of the bbolt database written by this package, stored under "version" in the "metadata" bucket.
+const schemaVersion = "0.0.2"
+
+// ErrNewerVersion is returned when opening a database written by a newer version of this package.
+var ErrNewerVersion = errors.New("WAL: database was written by a newer version, refusing to open it")
+
+// migration of the database from one schema version to the next.
+type migration struct {
+	from, to string
+	migrate  func(tx *bbolt.Tx) error
+}
+
+// migrations in the order they must be applied, the last one must end at schemaVersion.
+var migrations = []migration{
+	{from: "0.0.1", to: "0.0.2", migrate: migrateNestedBatchBuckets},
+}
+
+// parseVersion "major.minor.patch" into its numeric parts.
+func parseVersion(version string) ([3]int, error) {
+	var parsed [3]int
+
+	parts := strings.Split(version, ".")
+	if len(parts) != len(parsed) {
+		return parsed, fmt.Errorf("version (%v) is not in the form major.minor.patch", version)
+	}
+
+	for i := range parts {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("version (%v) has an invalid number (%v)", version, parts[i])
+		}
+		parsed[i] = n
+	}
+
+	return parsed, nil
+}
+
+// compareVersions a and b, returning -1 if a < b, 0 if a == b, and 1 if a > b.
+func compareVersions(a, b string) (int, error) {
+	av, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bv, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range av {
+		switch {
+		case av[i] < bv[i]:
+			return -1, nil
+		case av[i] > bv[i]:
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// storedVersion of the database, or "" if it has never been used by a WriteAheadLog.
+func storedVersion(db *bbolt.DB) (string, error) {
+	var version string
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		metadata := tx.Bucket([]byte("metadata"))
+		if metadata == nil {
+			return nil
+		}
+
+		version = string(metadata.Get([]byte("version")))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not view bbolt database to read version: %w", err)
+	}
+
+	return version, nil
+}
+
+// backupDatabase to a file next to the database before it is migrated away from version.
+func backupDatabase(db *bbolt.DB, version string) (string, error) {
+	backupPath := fmt.Sprintf("%v.%v-%v.bak", db.Path(), version, time.Now().Format("20060102T150405"))
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(backupPath, 0o600)
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not copy bbolt database to (%v): %w", backupPath, err)
+	}
+
+	return backupPath, nil
+}
+
+// migrate the database from version to schemaVersion, backing it up first.
+// All migrations are run inside of a single transaction, so a failure leaves the database untouched.
+func migrate(db *bbolt.DB, version string) error {
+	start := -1
+	for i := range migrations {
+		if migrations[i].from == version {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return fmt.Errorf("WAL: no migration exists from version (%v) to (%v)", version, schemaVersion)
+	}
+
+	backupPath, err := backupDatabase(db, version)
+	if err != nil {
+		return err
+	}
+	slog.Info("backed up WAL database before migrating", "from", version, "to", schemaVersion, "backup", backupPath)
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		metadata := tx.Bucket([]byte("metadata"))
+		if metadata == nil {
+			return errors.New("WAL: metadata bucket doesn't exist while migrating, bug/corruption?")
+		}
+
+		for _, m := range migrations[start:] {
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("could not migrate from version (%v) to (%v): %w", m.from, m.to, err)
+			}
+
+			if err := metadata.Put([]byte("version"), []byte(m.to)); err != nil {
+				return fmt.Errorf("could not set version to (%v): %w", m.to, err)
+			}
+
+			slog.Info("migrated WAL database", "from", m.from, "to", m.to)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update bbolt database to migrate it (backup at %v): %w", backupPath, err)
+	}
+
+	return nil
+}
+
+// migrateNestedBatchBuckets from version 0.0.1, where every batch bucket held its "dest" key next to its items,
+// to version 0.0.2 where each batch has a "meta" bucket and an "items" bucket.
+func migrateNestedBatchBuckets(tx *bbolt.Tx) error {
+	batches := tx.Bucket([]byte("batches"))
+	if batches == nil {
+		return errors.New("batches bucket doesn't exist in a version 0.0.1 database")
+	}
+
+	var ids [][]byte
+	err := batches.ForEachBucket(func(k []byte) error {
+		ids = append(ids, append([]byte{}, k...))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not iterate batches bucket: %w", err)
+	}
+
+	for _, id := range ids {
+		old := batches.Bucket(id)
+
+		// copy everything out before touching the bucket, bbolt doesn't allow modification during ForEach
+		var (
+			dest       []byte
+			keys, vals [][]byte
+		)
+		err := old.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return fmt.Errorf("batch (%v) contains nested bucket (%v) which version 0.0.1 never created", id, string(k))
+			}
+
+			if string(k) == "dest" {
+				dest = append([]byte{}, v...)
+				return nil
+			}
+
+			keys = append(keys, append([]byte{}, k...))
+			vals = append(vals, append([]byte{}, v...))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not iterate batch (%v): %w", id, err)
+		}
+
+		if dest == nil {
+			return fmt.Errorf("batch (%v) has no dest key", id)
+		}
+
+		if err := batches.DeleteBucket(id); err != nil {
+			return fmt.Errorf("could not delete old batch bucket (%v): %w", id, err)
+		}
+
+		batch, err := batches.CreateBucket(id)
+		if err != nil {
+			return fmt.Errorf("could not recreate batch bucket (%v): %w", id, err)
+		}
+
+		meta, err := batch.CreateBucket([]byte("meta"))
+		if err != nil {
+			return fmt.Errorf("could not create meta bucket in batch (%v): %w", id, err)
+		}
+
+		if err := meta.Put([]byte("dest"), dest); err != nil {
+			return fmt.Errorf("could not move dest into meta bucket of batch (%v): %w", id, err)
+		}
+
+		items, err := batch.CreateBucket([]byte("items"))
+		if err != nil {
+			return fmt.Errorf("could not create items bucket in batch (%v): %w", id, err)
+		}
+
+		for i := range keys {
+			if err := items.Put(keys[i], vals[i]); err != nil {
+				return fmt.Errorf("could not move item (%v) into items bucket of batch (%v): %w", string(keys[i]), id, err)
+			}
+		}
+	}
+
+	return nil
+}
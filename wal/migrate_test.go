@@ -0,0 +1,166 @@
+package wal
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestMigrateNestedBatchBuckets(t *testing.T) {
+	t.Parallel()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "wal.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// layout written by version 0.0.1
+	err = db.Update(func(tx *bbolt.Tx) error {
+		metadata, err := tx.CreateBucket([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		if err := metadata.Put([]byte("version"), []byte("0.0.1")); err != nil {
+			return err
+		}
+
+		batches, err := tx.CreateBucket([]byte("batches"))
+		if err != nil {
+			return err
+		}
+
+		batch, err := batches.CreateBucket([]byte{1})
+		if err != nil {
+			return err
+		}
+		if err := batch.Put([]byte("dest"), []byte("/remote")); err != nil {
+			return err
+		}
+		if err := batch.Put([]byte("/tmp/a"), []byte{}); err != nil {
+			return err
+		}
+		return batch.Put([]byte("/tmp/b"), []byte{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wal, err := NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := filepath.Glob(db.Path() + ".0.0.1-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup of the database before migrating, got %v", backups)
+	}
+
+	batches, err := wal.ListBatches()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch after migration, got %v", len(batches))
+	}
+
+	dest, err := batches[0].Destination()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dest != "/remote" {
+		t.Fatalf("expected destination (/remote), got (%v)", dest)
+	}
+
+	unfinished, err := batches[0].ListUnfinished()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(unfinished, []string{"/tmp/a", "/tmp/b"}) {
+		t.Fatalf("expected items [/tmp/a /tmp/b], got %v", unfinished)
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		if version := string(tx.Bucket([]byte("metadata")).Get([]byte("version"))); version != schemaVersion {
+			t.Errorf("expected version (%v) after migration, got (%v)", schemaVersion, version)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewerVersionRefused(t *testing.T) {
+	t.Parallel()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "wal.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		metadata, err := tx.CreateBucket([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		return metadata.Put([]byte("version"), []byte("99.0.0"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewWriteAheadLog(db); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("expected ErrNewerVersion, got %v", err)
+	}
+
+	version, err := storedVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != "99.0.0" {
+		t.Fatalf("version was overwritten to (%v)", version)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.0.1", "0.0.2", -1},
+		{"0.0.2", "0.0.2", 0},
+		{"0.1.0", "0.0.9", 1},
+		{"1.0.0", "0.10.10", 1},
+		{"0.0.10", "0.0.9", 1},
+	}
+
+	for _, test := range tests {
+		got, err := compareVersions(test.a, test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != test.want {
+			t.Errorf("compareVersions(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	if _, err := compareVersions("0.1", "0.0.1"); err == nil {
+		t.Error("expected error for malformed version")
+	}
+}
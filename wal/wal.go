@@ -1,42 +1,34 @@
 package wal
 
 import (
-	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
 
 type WriteAheadLog struct {
 	db *bbolt.DB
+
+	subscribersMu  sync.RWMutex
+	subscribers    map[uint64]*subscriber
+	nextSubscriber uint64
 }
 
 func (w *WriteAheadLog) NewBatch(dir string) (Batch, error) {
 	var bid []byte
-	err := w.db.Update(func(tx *bbolt.Tx) error {
-		batchesBucket := tx.Bucket([]byte("batches"))
-		if batchesBucket == nil {
-			return errors.New("WAL: batches bucket doesn't exist, bug/corruption?")
-		}
-
-		// Ignoring error as this can't error unless tx is closed or we are not
-		// in a writable transaction
-		id, _ := batchesBucket.NextSequence()
-		bid = binary.AppendUvarint(nil, id)
-
-		newBucket, err := batchesBucket.CreateBucket(bid)
+	err := w.db.Update(func(tx *bbolt.Tx) (err error) {
+		bid, err = createBatch(tx, dir)
 		if err != nil {
-			if errors.Is(err, bbolt.ErrBucketExists) {
-				return fmt.Errorf("bucket (%v) exists, even though it shouldn't. this is a bug: %w", id, err)
-			}
-			return fmt.Errorf("could not create bucket (%v): %w", id, err)
+			return err
 		}
 
-		if err := newBucket.Put([]byte("dest"), []byte(dir)); err != nil {
-			return fmt.Errorf("could not add destination metadata to the batch bucket (%v): %w", bid, err)
-		}
+		batchID := string(bid)
+		tx.OnCommit(func() { w.publish(Event{Type: BatchCreated, BatchID: batchID}) })
 
 		return nil
 	})
@@ -44,9 +36,55 @@ func (w *WriteAheadLog) NewBatch(dir string) (Batch, error) {
 		return Batch{}, fmt.Errorf("WAL: could not update bbolt database to create new batch: %w", err)
 	}
 
-	return newBatch(bid, w.db), nil
+	return newBatch(bid, w), nil
 }
 
+// createBatch uploading into dir in tx, returning its id.
+func createBatch(tx *bbolt.Tx, dir string) ([]byte, error) {
+	batchesBucket := tx.Bucket([]byte("batches"))
+	if batchesBucket == nil {
+		return nil, errors.New("WAL: batches bucket doesn't exist, bug/corruption?")
+	}
+
+	// Ignoring error as this can't error unless tx is closed or we are not
+	// in a writable transaction
+	id, _ := batchesBucket.NextSequence()
+	bid := binary.AppendUvarint(nil, id)
+
+	newBucket, err := batchesBucket.CreateBucket(bid)
+	if err != nil {
+		if errors.Is(err, bbolt.ErrBucketExists) {
+			return nil, fmt.Errorf("bucket (%v) exists, even though it shouldn't. this is a bug: %w", id, err)
+		}
+		return nil, fmt.Errorf("could not create bucket (%v): %w", id, err)
+	}
+
+	meta, err := newBucket.CreateBucket([]byte("meta"))
+	if err != nil {
+		return nil, fmt.Errorf("could not create meta bucket in batch (%v): %w", id, err)
+	}
+
+	if _, err := newBucket.CreateBucket([]byte("items")); err != nil {
+		return nil, fmt.Errorf("could not create items bucket in batch (%v): %w", id, err)
+	}
+
+	if err := meta.Put([]byte("dest"), []byte(dir)); err != nil {
+		return nil, fmt.Errorf("could not add destination metadata to the batch bucket (%v): %w", id, err)
+	}
+
+	created, err := time.Now().MarshalText()
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal creation time: %w", err)
+	}
+
+	if err := meta.Put([]byte("created"), created); err != nil {
+		return nil, fmt.Errorf("could not add creation time metadata to the batch bucket (%v): %w", id, err)
+	}
+
+	return bid, nil
+}
+
+// RemoveBatch from the WAL, moving a summary of it into the history.
 func (w *WriteAheadLog) RemoveBatch(b Batch) error {
 	err := w.db.Update(func(tx *bbolt.Tx) error {
 		batches := tx.Bucket([]byte("batches"))
@@ -54,6 +92,32 @@ func (w *WriteAheadLog) RemoveBatch(b Batch) error {
 			return errors.New("WAL: batches bucket doesn't exist, bug/corruption?")
 		}
 
+		history := tx.Bucket([]byte("history"))
+		if history == nil {
+			return errors.New("WAL: history bucket doesn't exist, bug/corruption?")
+		}
+
+		if batches.Bucket(b.id) == nil {
+			return fmt.Errorf("bucket (%v) not found in database: %w", string(b.id), bbolt.ErrBucketNotFound)
+		}
+
+		entry, err := summarizeBatch(tx, b.id, time.Now())
+		if err != nil {
+			return fmt.Errorf("could not summarize batch (%v) for history: %w", string(b.id), err)
+		}
+
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("could not marshal history entry json: %w", err)
+		}
+
+		if err := history.Put(historyKey(entry.Finished, b.id), value); err != nil {
+			return fmt.Errorf("could not add batch (%v) to history: %w", string(b.id), err)
+		}
+
+		batchID := string(b.id)
+		tx.OnCommit(func() { w.publish(Event{Type: BatchRemoved, BatchID: batchID, History: entry}) })
+
 		if err := batches.DeleteBucket(b.id); err != nil {
 			if errors.Is(err, bbolt.ErrBucketNotFound) {
 				return fmt.Errorf("bucket (%v) not found in database: %w", string(b.id), err)
@@ -62,7 +126,7 @@ func (w *WriteAheadLog) RemoveBatch(b Batch) error {
 		}
 
 		// Reset sequence when we finish all the buckets
-		if batches.Stats().BucketN-2 == 0 {
+		if k, _ := batches.Cursor().First(); k == nil {
 			if err := batches.SetSequence(0); err != nil {
 				return fmt.Errorf("could not set sequence number to 0: %w", err)
 			}
@@ -86,15 +150,9 @@ func (w *WriteAheadLog) ListBatches() ([]Batch, error) {
 			return errors.New("WAL: batches bucket doesn't exist while trying to list batches, this likely means database corruption")
 		}
 
-		batches = make([]Batch, 0, bucket.Stats().KeyN)
-
-		err := bucket.ForEach(func(k, _ []byte) error {
-			if bytes.Equal(k, []byte("dest")) {
-				return nil
-			}
-
+		err := bucket.ForEachBucket(func(k []byte) error {
 			// Copy ID into new byte slice, as keys are valid only in the transaction
-			batches = append(batches, newBatch(append([]byte{}, k...), w.db))
+			batches = append(batches, newBatch(append([]byte{}, k...), w))
 			return nil
 		})
 		if err != nil {
@@ -110,16 +168,42 @@ func (w *WriteAheadLog) ListBatches() ([]Batch, error) {
 	return batches, nil
 }
 
+// NewWriteAheadLog using db, creating the buckets it needs and migrating older layouts to the current one.
+// A database written by a newer version of this package returns ErrNewerVersion.
 func NewWriteAheadLog(db *bbolt.DB) (*WriteAheadLog, error) {
-	err := db.Update(func(tx *bbolt.Tx) error {
+	version, err := storedVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if version != "" {
+		cmp, err := compareVersions(version, schemaVersion)
+		if err != nil {
+			return nil, fmt.Errorf("WAL: invalid database version: %w", err)
+		}
+
+		if cmp > 0 {
+			return nil, fmt.Errorf("%w: database version (%v), supported version (%v)", ErrNewerVersion, version, schemaVersion)
+		}
+
+		if cmp < 0 {
+			if err := migrate(db, version); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
 		// Add metadata about our database versions for potential migrations
 		metadata, err := tx.CreateBucketIfNotExists([]byte("metadata"))
 		if err != nil {
 			return fmt.Errorf("could not create \"metadata\" bucket in bbolt: %w", err)
 		}
 
-		if err := metadata.Put([]byte("version"), []byte("0.0.1")); err != nil {
-			return fmt.Errorf("could not add version metadata to bbolt: %w", err)
+		if version == "" {
+			if err := metadata.Put([]byte("version"), []byte(schemaVersion)); err != nil {
+				return fmt.Errorf("could not add version metadata to bbolt: %w", err)
+			}
 		}
 
 		// Add bucket to store a list of all our active batches
@@ -128,10 +212,16 @@ func NewWriteAheadLog(db *bbolt.DB) (*WriteAheadLog, error) {
 			return fmt.Errorf("could not create \"batches\" bucket in bbolt: %w", err)
 		}
 
+		// Add bucket to store summaries of removed batches
+		_, err = tx.CreateBucketIfNotExists([]byte("history"))
+		if err != nil {
+			return fmt.Errorf("could not create \"history\" bucket in bbolt: %w", err)
+		}
+
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("could not update bbolt database to contain WriteAheadLog")
+		return nil, fmt.Errorf("could not update bbolt database to contain WriteAheadLog: %w", err)
 	}
 
 	wal := &WriteAheadLog{
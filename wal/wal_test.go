@@ -1,12 +1,38 @@
 package wal
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/simplylib/errgroup"
 	"go.etcd.io/bbolt"
 )
 
+// newTestWAL backed by a bbolt database in a temporary directory that is closed when the test finishes.
+func newTestWAL(t *testing.T) *WriteAheadLog {
+	t.Helper()
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "wal.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	wal, err := NewWriteAheadLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wal
+}
+
 func TestWAL(t *testing.T) {
 	t.Parallel()
 